@@ -1,12 +1,50 @@
 package eth1
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
-const depositContractABI = "[{\"name\":\"DepositEvent\",\"inputs\":[{\"type\":\"bytes\",\"name\":\"pubkey\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"withdrawal_credentials\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"amount\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"signature\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"index\",\"indexed\":false}],\"anonymous\":false,\"type\":\"event\"},{\"outputs\":[],\"inputs\":[{\"type\":\"uint256\",\"name\":\"minDeposit\"},{\"type\":\"address\",\"name\":\"_drain_address\"}],\"constant\":false,\"payable\":false,\"type\":\"constructor\"},{\"name\":\"get_hash_tree_root\",\"outputs\":[{\"type\":\"bytes32\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":91734},{\"name\":\"get_deposit_count\",\"outputs\":[{\"type\":\"bytes\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":10493},{\"name\":\"deposit\",\"outputs\":[],\"inputs\":[{\"type\":\"bytes\",\"name\":\"pubkey\"},{\"type\":\"bytes\",\"name\":\"withdrawal_credentials\"},{\"type\":\"bytes\",\"name\":\"signature\"}],\"constant\":false,\"payable\":true,\"type\":\"function\",\"gas\":1334707},{\"name\":\"drain\",\"outputs\":[],\"inputs\":[],\"constant\":false,\"payable\":false,\"type\":\"function\",\"gas\":35823},{\"name\":\"MIN_DEPOSIT_AMOUNT\",\"outputs\":[{\"type\":\"uint256\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":663},{\"name\":\"deposit_count\",\"outputs\":[{\"type\":\"uint256\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":693},{\"name\":\"drain_address\",\"outputs\":[{\"type\":\"address\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":723}]"
+const depositGasLimit = 1000000
+
+// DepositContractCode is the code served at the address of the deposit contract. The
+// mock answers calls to the deposit contract itself, so the code only needs to be
+// non-empty for clients checking that the contract is deployed, and reverts if run.
+var DepositContractCode = []byte{0x60, 0x00, 0x60, 0x00, 0xfd} // PUSH1 0 PUSH1 0 REVERT
+
+var (
+	// ErrExecutionReverted is returned for calls which the deposit contract reverts.
+	ErrExecutionReverted = errors.New("execution reverted")
+	// drainAddress is the address allowed to drain the deposit contract, which
+	// nobody can do on the mock.
+	drainAddress = common.Address{}
+	// gweiInWei is the number of wei in a gwei, the unit of deposit amounts.
+	gweiInWei = big.NewInt(1e9)
+	// depositorKey signs the synthetic transactions of the deposits which were not
+	// submitted through a transaction, such as the deposits from the keystore.
+	depositorKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+)
+
+const depositContractABI = "[{\"name\":\"DepositEvent\",\"inputs\":[{\"type\":\"bytes\",\"name\":\"pubkey\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"withdrawal_credentials\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"amount\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"signature\",\"indexed\":false},{\"type\":\"bytes\",\"name\":\"index\",\"indexed\":false}],\"anonymous\":false,\"type\":\"event\"},{\"outputs\":[],\"inputs\":[{\"type\":\"uint256\",\"name\":\"minDeposit\"},{\"type\":\"address\",\"name\":\"_drain_address\"}],\"constant\":false,\"payable\":false,\"type\":\"constructor\"},{\"name\":\"get_hash_tree_root\",\"outputs\":[{\"type\":\"bytes32\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":91734},{\"name\":\"get_deposit_root\",\"outputs\":[{\"type\":\"bytes32\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":95628},{\"name\":\"get_deposit_count\",\"outputs\":[{\"type\":\"bytes\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":10493},{\"name\":\"deposit\",\"outputs\":[],\"inputs\":[{\"type\":\"bytes\",\"name\":\"pubkey\"},{\"type\":\"bytes\",\"name\":\"withdrawal_credentials\"},{\"type\":\"bytes\",\"name\":\"signature\"}],\"constant\":false,\"payable\":true,\"type\":\"function\",\"gas\":1334707},{\"name\":\"drain\",\"outputs\":[],\"inputs\":[],\"constant\":false,\"payable\":false,\"type\":\"function\",\"gas\":35823},{\"name\":\"MIN_DEPOSIT_AMOUNT\",\"outputs\":[{\"type\":\"uint256\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":663},{\"name\":\"deposit_count\",\"outputs\":[{\"type\":\"uint256\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":693},{\"name\":\"drain_address\",\"outputs\":[{\"type\":\"address\",\"name\":\"out\"}],\"inputs\":[],\"constant\":true,\"payable\":false,\"type\":\"function\",\"gas\":723}]"
+
+// depositContractAbi is the ABI of the deposit contract, parsed once as it is used to
+// answer every call and to encode every deposit.
+var depositContractAbi = mustParseABI(depositContractABI)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
 
 // packDepositLog uses the deposit contract ABI to pack raw information
 // into an encoded set of bytes to be included in the Data field of a
@@ -18,19 +56,109 @@ func packDepositLog(
 	signature []byte,
 	index []byte,
 ) ([]byte, error) {
-	reader := bytes.NewReader([]byte(depositContractABI))
-	contractAbi, err := abi.JSON(reader)
+	return depositContractAbi.Events["DepositEvent"].Inputs.Pack(pubkey, withdrawalCredentials, amount, signature, index)
+}
+
+// PackDepositContractCall packs a call to a function of the deposit contract.
+func PackDepositContractCall(method string, args ...interface{}) ([]byte, error) {
+	return depositContractAbi.Pack(method, args...)
+}
+
+// CallDepositContract answers a call to a constant function of the deposit contract,
+// given the ABI encoded call data, for a contract which received the given number of
+// deposits, whose deposit tree has the given root. It returns the ABI encoded outputs
+// of the function, or ErrExecutionReverted if the call does not match any constant
+// function.
+func CallDepositContract(data []byte, count uint64, root [32]byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, ErrExecutionReverted
+	}
+	method, err := depositContractAbi.MethodById(data[:4])
 	if err != nil {
-		return nil, err
+		return nil, ErrExecutionReverted
+	}
+	switch method.Name {
+	case "get_deposit_count":
+		depCount := DepositCount(count)
+		return method.Outputs.Pack(depCount[:])
+	case "get_deposit_root", "get_hash_tree_root":
+		return method.Outputs.Pack(root)
+	case "deposit_count":
+		return method.Outputs.Pack(new(big.Int).SetUint64(count))
+	case "MIN_DEPOSIT_AMOUNT":
+		return method.Outputs.Pack(new(big.Int).SetUint64(MinDepositAmount))
+	case "drain_address":
+		return method.Outputs.Pack(drainAddress)
+	default:
+		return nil, ErrExecutionReverted
 	}
-	return contractAbi.Events["DepositEvent"].Inputs.Pack(pubkey, withdrawalCredentials, amount, signature, index)
 }
 
-func PackDepositCount(count []byte) ([]byte, error) {
-	reader := bytes.NewReader([]byte(depositContractABI))
-	contractAbi, err := abi.JSON(reader)
+// DepositCallData packs a call to the deposit function of the deposit contract
+// submitting the given deposit, to be sent along with its amount in wei.
+func DepositCallData(deposit *DepositData) ([]byte, error) {
+	return depositContractAbi.Pack("deposit", deposit.Pubkey, deposit.WithdrawalCredentials, deposit.Signature)
+}
+
+// DepositValue returns the amount of a deposit in wei, which is the value sent along
+// with the call to the deposit function.
+func DepositValue(deposit *DepositData) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(deposit.Amount), gweiInWei)
+}
+
+// DepositTransactions returns a synthetic signed transaction calling the deposit function
+// of the deposit contract at the given address for every deposit, sent by the same
+// depositor with increasing nonces, so that every deposit has a transaction with a
+// unique hash.
+func DepositTransactions(deposits []*DepositData, contract common.Address) ([]*types.Transaction, error) {
+	txs := make([]*types.Transaction, len(deposits))
+	for i, deposit := range deposits {
+		data, err := DepositCallData(deposit)
+		if err != nil {
+			return nil, err
+		}
+		tx := types.NewTransaction(uint64(i), contract, DepositValue(deposit), depositGasLimit, big.NewInt(1), data)
+		txs[i], err = types.SignTx(tx, types.HomesteadSigner{}, depositorKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+// DecodeDepositTransaction decodes a transaction calling the deposit function of the
+// deposit contract into the deposit data it submits, converting the value sent along
+// with the transaction into the deposit amount in gwei. The deposit is not verified.
+func DecodeDepositTransaction(tx *types.Transaction) (*DepositData, error) {
+	if tx.To() == nil {
+		return nil, errors.New("transaction does not call a contract")
+	}
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil, errors.New("transaction data is too short to contain a method selector")
+	}
+	method, err := depositContractAbi.MethodById(data[:4])
 	if err != nil {
 		return nil, err
 	}
-	return contractAbi.Methods["get_deposit_count"].Outputs.Pack(count)
+	if method.Name != "deposit" {
+		return nil, fmt.Errorf("transaction calls %s instead of deposit", method.Name)
+	}
+	values, err := method.Inputs.UnpackValues(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	amount, remainder := new(big.Int).QuoRem(tx.Value(), gweiInWei, new(big.Int))
+	if remainder.Sign() != 0 {
+		return nil, fmt.Errorf("deposit value %s wei is not a whole number of gwei", tx.Value())
+	}
+	if !amount.IsUint64() {
+		return nil, fmt.Errorf("deposit value %s wei is too large", tx.Value())
+	}
+	return &DepositData{
+		Pubkey:                values[0].([]byte),
+		WithdrawalCredentials: values[1].([]byte),
+		Amount:                amount.Uint64(),
+		Signature:             values[2].([]byte),
+	}, nil
 }
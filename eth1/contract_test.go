@@ -0,0 +1,39 @@
+package eth1
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestDecodeDepositTransaction(t *testing.T) {
+	deposit := testDepositData(t, MaxEffectiveBalance)
+	data, err := DepositCallData(deposit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(0, common.Address{}, DepositValue(deposit), 1000000, nil, data)
+	decoded, err := DecodeDepositTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Amount != deposit.Amount {
+		t.Errorf("Expected amount %d, received %d", deposit.Amount, decoded.Amount)
+	}
+	if !bytes.Equal(decoded.Pubkey, deposit.Pubkey) ||
+		!bytes.Equal(decoded.WithdrawalCredentials, deposit.WithdrawalCredentials) ||
+		!bytes.Equal(decoded.Signature, deposit.Signature) {
+		t.Errorf("Expected decoded deposit %+v, received %+v", deposit, decoded)
+	}
+
+	tx = types.NewTransaction(0, common.Address{}, DepositValue(deposit), 1000000, nil, data[:3])
+	if _, err := DecodeDepositTransaction(tx); err == nil {
+		t.Error("Expected an error decoding a transaction without a method selector")
+	}
+	tx = types.NewContractCreation(0, DepositValue(deposit), 1000000, nil, data)
+	if _, err := DecodeDepositTransaction(tx); err == nil {
+		t.Error("Expected an error decoding a contract creation")
+	}
+}
@@ -0,0 +1,208 @@
+package eth1
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/prysmaticlabs/go-ssz"
+	"github.com/prysmaticlabs/prysm/shared/hashutil"
+)
+
+// zeroHashes[i] is the root of a subtree of height i whose leaves are all empty.
+var zeroHashes = computeZeroHashes()
+
+func computeZeroHashes() [][32]byte {
+	hashes := make([][32]byte, depositContractTreeDepth+1)
+	for i := uint64(0); i < depositContractTreeDepth; i++ {
+		hashes[i+1] = hashPair(hashes[i], hashes[i])
+	}
+	return hashes
+}
+
+// DepositTree is an incremental Merkle tree of deposits, which has the same root as the
+// deposit contract and DepositRoot. Like the deposit contract, it keeps the branch of
+// the tree needed to insert the next leaf, so an insertion hashes one node per level
+// of the tree at most. The root of the tree is cached after every insertion, so the root
+// as of any earlier number of deposits is looked up without hashing. The nodes of every
+// complete subtree are kept as well, to build proofs against any earlier root.
+type DepositTree struct {
+	branch [][32]byte
+	layers [][][32]byte // layers[h] holds the roots of the complete subtrees of height h.
+	roots  [][32]byte   // roots[i] is the root of the tree of the first i deposits.
+}
+
+// NewDepositTree creates an empty deposit tree.
+func NewDepositTree() *DepositTree {
+	return &DepositTree{
+		branch: make([][32]byte, depositContractTreeDepth),
+		layers: make([][][32]byte, depositContractTreeDepth+1),
+		roots:  [][32]byte{mixInCount(zeroHashes[depositContractTreeDepth], 0)},
+	}
+}
+
+// DepositLeaf returns the leaf of a deposit in the deposit tree, which is the hash
+// tree root of its data.
+func DepositLeaf(deposit *DepositData) ([32]byte, error) {
+	return ssz.HashTreeRoot(deposit)
+}
+
+// DepositLeaves returns the leaves of a list of deposits in the deposit tree.
+func DepositLeaves(deposits []*DepositData) ([][32]byte, error) {
+	leaves := make([][32]byte, len(deposits))
+	for i, deposit := range deposits {
+		leaf, err := DepositLeaf(deposit)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+	}
+	return leaves, nil
+}
+
+// Insert appends the leaf of a deposit to the tree, following the deposit function of
+// the deposit contract.
+func (t *DepositTree) Insert(leaf [32]byte) {
+	t.layers[0] = append(t.layers[0], leaf)
+	node := leaf
+	size := t.Count()
+	for height := uint64(0); height < depositContractTreeDepth; height++ {
+		if size&1 == 1 {
+			t.branch[height] = node
+			break
+		}
+		node = hashPair(t.branch[height], node)
+		t.layers[height+1] = append(t.layers[height+1], node)
+		size /= 2
+	}
+	t.roots = append(t.roots, t.computeRoot())
+}
+
+// computeRoot computes the root of the tree from its branch, following the
+// get_deposit_root function of the deposit contract.
+func (t *DepositTree) computeRoot() [32]byte {
+	var node [32]byte
+	size := t.Count()
+	for height := uint64(0); height < depositContractTreeDepth; height++ {
+		if size&1 == 1 {
+			node = hashPair(t.branch[height], node)
+		} else {
+			node = hashPair(node, zeroHashes[height])
+		}
+		size /= 2
+	}
+	return mixInCount(node, t.Count())
+}
+
+// Count returns the number of deposits in the tree.
+func (t *DepositTree) Count() uint64 {
+	return uint64(len(t.layers[0]))
+}
+
+// Root returns the root of the tree.
+func (t *DepositTree) Root() [32]byte {
+	return t.roots[len(t.roots)-1]
+}
+
+// RootAt returns the root the tree had when it held the given number of deposits.
+func (t *DepositTree) RootAt(count uint64) ([32]byte, error) {
+	if count > t.Count() {
+		return [32]byte{}, fmt.Errorf("deposit tree holds %d deposits, not %d", t.Count(), count)
+	}
+	return t.roots[count], nil
+}
+
+// Proof returns the Merkle proof of the deposit at the given index against the root
+// the tree had when it held the given number of deposits. The proof is made of the
+// siblings of the leaf at every level of the tree, followed by the number of deposits
+// mixed into the root, as expected in the Deposit objects of eth2 blocks.
+func (t *DepositTree) Proof(index uint64, count uint64) ([][32]byte, error) {
+	if count > t.Count() {
+		return nil, fmt.Errorf("deposit tree holds %d deposits, not %d", t.Count(), count)
+	}
+	if index >= count {
+		return nil, fmt.Errorf("deposit %d is not in a tree of %d deposits", index, count)
+	}
+	proof := make([][32]byte, depositContractTreeDepth+1)
+	for height := uint64(0); height < depositContractTreeDepth; height++ {
+		proof[height] = t.node(height, (index>>height)^1, count)
+	}
+	binary.LittleEndian.PutUint64(proof[depositContractTreeDepth][:8], count)
+	return proof, nil
+}
+
+// node returns the root of the subtree of the given height at the given position, in
+// the tree of the given number of deposits. Only the subtree holding the last deposit
+// at each height is not complete, so at most one node per level is hashed.
+func (t *DepositTree) node(height uint64, i uint64, count uint64) [32]byte {
+	if i<<height >= count {
+		return zeroHashes[height]
+	}
+	if (i+1)<<height <= count {
+		return t.layers[height][i]
+	}
+	return hashPair(t.node(height-1, 2*i, count), t.node(height-1, 2*i+1, count))
+}
+
+// Truncate removes every deposit after the given number of deposits from the tree.
+// The cached roots and complete subtrees of the remaining deposits stay valid, and the
+// branch is made of the last complete subtrees whose sibling is still missing.
+func (t *DepositTree) Truncate(count uint64) {
+	if count >= t.Count() {
+		return
+	}
+	// The layers and roots are capped so that later insertions do not overwrite
+	// those shared with copies of the tree.
+	for height := range t.layers {
+		n := count >> uint64(height)
+		t.layers[height] = t.layers[height][:n:n]
+	}
+	t.roots = t.roots[: count+1 : count+1]
+	t.branch = make([][32]byte, depositContractTreeDepth)
+	for height := range t.branch {
+		if n := count >> uint64(height); n&1 == 1 {
+			t.branch[height] = t.layers[height][n-1]
+		}
+	}
+}
+
+// Copy returns a copy of the tree which is not affected by later changes to the tree.
+func (t *DepositTree) Copy() *DepositTree {
+	layers := make([][][32]byte, len(t.layers))
+	for height, layer := range t.layers {
+		layers[height] = layer[:len(layer):len(layer)]
+	}
+	return &DepositTree{
+		branch: append([][32]byte{}, t.branch...),
+		layers: layers,
+		roots:  t.roots[:len(t.roots):len(t.roots)],
+	}
+}
+
+// VerifyDepositProof checks a Merkle proof of the deposit with the given leaf and
+// index against the root of a deposit tree, like eth2 clients verify deposits.
+func VerifyDepositProof(leaf [32]byte, proof [][32]byte, index uint64, root [32]byte) bool {
+	if uint64(len(proof)) != depositContractTreeDepth+1 {
+		return false
+	}
+	node := leaf
+	for height, sibling := range proof {
+		if (index>>uint64(height))&1 == 1 {
+			node = hashPair(sibling, node)
+		} else {
+			node = hashPair(node, sibling)
+		}
+	}
+	return node == root
+}
+
+func hashPair(left [32]byte, right [32]byte) [32]byte {
+	return hashutil.Hash(append(append(make([]byte, 0, 64), left[:]...), right[:]...))
+}
+
+// mixInCount mixes the number of deposits into the root of the tree, encoded as a
+// 32 byte little endian integer like the length of an SSZ list.
+func mixInCount(node [32]byte, count uint64) [32]byte {
+	var length [32]byte
+	binary.LittleEndian.PutUint64(length[:8], count)
+	return hashPair(node, length)
+}
@@ -0,0 +1,192 @@
+package eth1
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/shared/hashutil"
+)
+
+func TestDepositTree_MatchesDepositRoot(t *testing.T) {
+	deposits := make([]*DepositData, 0)
+	tree := NewDepositTree()
+	for i := 0; i <= 5; i++ {
+		expected, err := DepositRoot(deposits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root := tree.Root(); root != expected {
+			t.Errorf("Expected root %#x of %d deposits, received %#x", expected, i, root)
+		}
+		deposit := testDepositData(t, MaxEffectiveBalance-uint64(i))
+		leaf, err := DepositLeaf(deposit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deposits = append(deposits, deposit)
+		tree.Insert(leaf)
+	}
+
+	for i := 0; i <= len(deposits); i++ {
+		expected, err := DepositRoot(deposits[:i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root, err := tree.RootAt(uint64(i)); err != nil || root != expected {
+			t.Errorf("Expected cached root %#x of %d deposits, received %#x (%v)", expected, i, root, err)
+		}
+	}
+	if _, err := tree.RootAt(uint64(len(deposits) + 1)); err == nil {
+		t.Error("Expected an error getting the root of more deposits than inserted")
+	}
+}
+
+func TestDepositTree_TruncateCopy(t *testing.T) {
+	tree := NewDepositTree()
+	for i := 0; i < 7; i++ {
+		tree.Insert(testLeaf(i))
+	}
+	snapshot := tree.Copy()
+	rootOfThree := tree.roots[3]
+
+	tree.Truncate(3)
+	if tree.Count() != 3 || tree.Root() != rootOfThree {
+		t.Errorf("Expected the root of 3 deposits after truncating, received %#x", tree.Root())
+	}
+	rebuilt := NewDepositTree()
+	for i := 0; i < 3; i++ {
+		rebuilt.Insert(testLeaf(i))
+	}
+	// Inserting after truncating must give the same roots as a tree which never held
+	// the removed deposits.
+	for i := 10; i < 14; i++ {
+		tree.Insert(testLeaf(i))
+		rebuilt.Insert(testLeaf(i))
+		if tree.Root() != rebuilt.Root() {
+			t.Fatalf("Expected root %#x after inserting into a truncated tree, received %#x", rebuilt.Root(), tree.Root())
+		}
+	}
+
+	if snapshot.Count() != 7 {
+		t.Errorf("Expected the copy to keep 7 deposits, received %d", snapshot.Count())
+	}
+	for i := 0; i < 7; i++ {
+		if snapshot.layers[0][i] != testLeaf(i) {
+			t.Errorf("Expected leaf %d of the copy to be left untouched", i)
+		}
+	}
+}
+
+func TestDepositTree_Proof(t *testing.T) {
+	tree := NewDepositTree()
+	for i := 0; i < 11; i++ {
+		tree.Insert(testLeaf(i))
+	}
+	// Proofs are built against the root of the tree as of any number of deposits.
+	for count := uint64(1); count <= tree.Count(); count++ {
+		root, err := tree.RootAt(count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for index := uint64(0); index < count; index++ {
+			proof, err := tree.Proof(index, count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(proof) != 33 {
+				t.Fatalf("Expected a proof of 33 nodes, received %d", len(proof))
+			}
+			if !VerifyDepositProof(testLeaf(int(index)), proof, index, root) {
+				t.Errorf("Expected the proof of deposit %d in a tree of %d deposits to be valid", index, count)
+			}
+			if VerifyDepositProof(testLeaf(int(index)), proof, index^1, root) {
+				t.Errorf("Expected the proof of deposit %d to be invalid for another index", index)
+			}
+		}
+	}
+
+	tree.Truncate(6)
+	tree.Insert(testLeaf(20))
+	proof, err := tree.Proof(6, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyDepositProof(testLeaf(20), proof, 6, tree.Root()) {
+		t.Error("Expected the proof of a deposit inserted after truncating to be valid")
+	}
+
+	if _, err := tree.Proof(7, 7); err == nil {
+		t.Error("Expected an error proving a deposit which is not in the tree")
+	}
+	if _, err := tree.Proof(0, 8); err == nil {
+		t.Error("Expected an error proving a deposit against more deposits than inserted")
+	}
+}
+
+func testLeaf(i int) [32]byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(i))
+	return hashutil.Hash(buf[:])
+}
+
+// BenchmarkDepositTree_Insert inserts into trees of increasing sizes. As an insertion
+// hashes one node per level of the tree at most, the time per insertion stays about
+// the same whatever the size of the tree.
+func BenchmarkDepositTree_Insert(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			tree := NewDepositTree()
+			for i := 0; i < size; i++ {
+				tree.Insert(testLeaf(i))
+			}
+			leaves := make([][32]byte, b.N)
+			for i := range leaves {
+				leaves[i] = testLeaf(size + i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.Insert(leaves[i])
+			}
+		})
+	}
+}
+
+// BenchmarkDepositTree_RootAt looks up the roots of trees of increasing sizes, which
+// are cached and take constant time.
+func BenchmarkDepositTree_RootAt(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			tree := NewDepositTree()
+			for i := 0; i < size; i++ {
+				tree.Insert(testLeaf(i))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := tree.RootAt(uint64(i % size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDepositRoot hashes every deposit to compute the root, for comparison with
+// the deposit tree.
+func BenchmarkDepositRoot(b *testing.B) {
+	deposits := make([]*DepositData, 1000)
+	for i := range deposits {
+		deposits[i] = &DepositData{
+			Pubkey:                make([]byte, 48),
+			WithdrawalCredentials: make([]byte, 32),
+			Amount:                uint64(i),
+			Signature:             make([]byte, 96),
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DepositRoot(deposits); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
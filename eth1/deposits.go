@@ -1,6 +1,9 @@
 package eth1
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/prysmaticlabs/go-ssz"
 	"github.com/prysmaticlabs/prysm/shared/bls"
 	"github.com/prysmaticlabs/prysm/shared/hashutil"
@@ -8,7 +11,9 @@ import (
 
 var (
 	// MaxEffectiveBalance of an active eth2 validator.
-	MaxEffectiveBalance      = uint64(32 * 1e9)
+	MaxEffectiveBalance = uint64(32 * 1e9)
+	// MinDepositAmount accepted by the deposit contract, in gwei.
+	MinDepositAmount         = uint64(1e9)
 	blsWithdrawalPrefixByte  = byte(0)
 	domainDeposit            = [4]byte{3, 0, 0, 0}
 	genesisForkVersion       = [4]byte{0, 0, 0, 0}
@@ -56,24 +61,61 @@ func CreateDepositData(validatorKey []byte, withdrawalKey []byte, amountInGwei u
 		Amount:                amountInGwei,
 	}
 
-	sr, err := ssz.SigningRoot(di)
+	rt, err := signingRoot(di)
 	if err != nil {
 		return nil, err
 	}
+
+	di.Signature = sk1.Sign(rt[:]).Marshal()
+	return di, nil
+}
+
+// VerifyDepositData checks that a deposit is signed by the private key of its public
+// key, over the same signing root as deposits created by CreateDepositData, and that
+// its amount is at least the minimum deposit amount.
+func VerifyDepositData(di *DepositData) error {
+	if len(di.Pubkey) != 48 {
+		return fmt.Errorf("public key has length %d, expected 48", len(di.Pubkey))
+	}
+	if len(di.WithdrawalCredentials) != 32 {
+		return fmt.Errorf("withdrawal credentials have length %d, expected 32", len(di.WithdrawalCredentials))
+	}
+	if di.Amount < MinDepositAmount {
+		return fmt.Errorf("deposit amount %d gwei is less than the minimum of %d gwei", di.Amount, MinDepositAmount)
+	}
+	pub, err := bls.PublicKeyFromBytes(di.Pubkey)
+	if err != nil {
+		return err
+	}
+	sig, err := bls.SignatureFromBytes(di.Signature)
+	if err != nil {
+		return err
+	}
+	rt, err := signingRoot(di)
+	if err != nil {
+		return err
+	}
+	if !sig.Verify(rt[:], pub) {
+		return errors.New("invalid deposit signature")
+	}
+	return nil
+}
+
+// signingRoot returns the root signed by the validator key of a deposit, which
+// covers every field of the deposit but its signature.
+func signingRoot(di *DepositData) ([32]byte, error) {
+	sr, err := ssz.SigningRoot(di)
+	if err != nil {
+		return [32]byte{}, err
+	}
 	d, err := domain()
 	if err != nil {
-		return nil, err
+		return [32]byte{}, err
 	}
-	rt, err := ssz.HashTreeRoot(&SigningRoot{
+	return ssz.HashTreeRoot(&SigningRoot{
 		ObjectRoot: sr,
 		Domain:     d,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	di.Signature = sk1.Sign(rt[:]).Marshal()
-	return di, nil
 }
 
 // withdrawalCredentialsHash forms a 32 byte hash of the withdrawal public
@@ -0,0 +1,32 @@
+package eth1
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testDepositData(t *testing.T, amount uint64) *DepositData {
+	deposit, err := CreateDepositData(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deposit
+}
+
+func TestVerifyDepositData(t *testing.T) {
+	deposit := testDepositData(t, MaxEffectiveBalance)
+	if err := VerifyDepositData(deposit); err != nil {
+		t.Errorf("Expected a deposit created from keys to be valid, received %v", err)
+	}
+
+	tampered := *deposit
+	tampered.Amount = MinDepositAmount
+	if err := VerifyDepositData(&tampered); err == nil {
+		t.Error("Expected an error verifying a deposit whose amount differs from the signed amount")
+	}
+
+	tooSmall := testDepositData(t, MinDepositAmount-1)
+	if err := VerifyDepositData(tooSmall); err == nil {
+		t.Error("Expected an error verifying a deposit below the minimum amount")
+	}
+}
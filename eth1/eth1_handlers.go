@@ -11,109 +11,145 @@ import (
 	"github.com/prysmaticlabs/prysm/shared/hashutil"
 )
 
+// blockGasLimit is the gas limit of blocks, which is raised to the gas used by blocks
+// including more deposit transactions than fit under it.
+const blockGasLimit = 10000000
+
 // DepositRoot produces a hash tree root of a list of deposits
-// to match the output of the deposit contract on the eth1 chain.
+// to match the output of the deposit contract on the eth1 chain. It hashes every
+// deposit, so a DepositTree should be used to follow the root as deposits are made.
 func DepositRoot(deposits []*DepositData) ([32]byte, error) {
 	return ssz.HashTreeRootWithCapacity(deposits, 1<<depositContractTreeDepth)
 }
 
-// DepositMethodID returns the ABI encoded method value as a hex string.
-func DepositMethodID() string {
-	methodHash := hashutil.HashKeccak256([]byte("get_deposit_count()"))
-	return "data\":\"0x" + common.Bytes2Hex(methodHash[:4]) + "\""
-}
-
-// DepositLogsID returns the event hash from the ABI corresponding to
-// fetching the deposit logs event.
-func DepositLogsID() string {
-	methodHash := hashutil.HashKeccak256([]byte("get_deposit_root()"))
-	return "data\":\"0x" + common.Bytes2Hex(methodHash[:4]) + "\""
-}
-
 // DepositCount returns an encoded number of deposits.
-func DepositCount(deposits []*DepositData) [8]byte {
-	count := uint64(len(deposits))
+func DepositCount(count uint64) [8]byte {
 	var depCount [8]byte
 	binary.LittleEndian.PutUint64(depCount[:], count)
 	return depCount
 }
 
-// ConstructBlocksByNumber builds a list of historical blocks down to block 0 from some current block number,
+// ConstructBlocksByNumber builds a list of historical blocks from block 0 up to some current block number,
 // used to simulate a real eth1 chain which can be queried for all of its blocks by their respective number.
-func ConstructBlocksByNumber(currentBlockNum uint64, blockTime time.Duration) map[uint64]*types.Header {
+// Every header links to the hash of its parent, and the whole history is derived deterministically
+// from the genesis timestamp, the block time and a seed.
+func ConstructBlocksByNumber(
+	currentBlockNum uint64,
+	genesisTime uint64,
+	blockTime time.Duration,
+	seed []byte,
+) map[uint64]*types.Header {
 	m := make(map[uint64]*types.Header)
-	currentTime := uint64(time.Now().Unix())
-	for i := currentBlockNum; i > 0; i-- {
-		header := &types.Header{
-			ParentHash:  common.Hash([32]byte{}),
-			UncleHash:   types.EmptyUncleHash,
-			Coinbase:    common.Address([20]byte{}),
-			Root:        common.Hash([32]byte{}),
-			TxHash:      types.EmptyRootHash,
-			ReceiptHash: common.Hash([32]byte{}),
-			Bloom:       types.Bloom{},
-			Difficulty:  big.NewInt(20),
-			Number:      big.NewInt(int64(i)),
-			GasLimit:    100,
-			GasUsed:     100,
-			Time:        currentTime,
-			Extra:       []byte("hello world"),
-		}
+	parentHash := common.Hash([32]byte{})
+	for i := uint64(0); i <= currentBlockNum; i++ {
+		header := BlockHeader(i, parentHash, genesisTime+i*uint64(blockTime.Seconds()), seed, nil, nil)
 		m[i] = header
-		currentTime = currentTime - uint64(blockTime.Seconds())
+		parentHash = header.Hash()
 	}
 	return m
 }
 
-// BlockHeader returns a block header with time.Now and a blockNum.
-func BlockHeader(blockNum uint64) *types.Header {
+// BlockHeader returns a block header for a blockNum on top of the given parent hash.
+// The seed is mixed into the header so that chains built from different seeds
+// do not share any block hashes. The transactions root, receipts root and logs bloom
+// of the header are computed from the transactions included in the block and their
+// receipts, whose cumulative gas is the gas used by the block.
+func BlockHeader(
+	blockNum uint64,
+	parentHash common.Hash,
+	timestamp uint64,
+	seed []byte,
+	txs types.Transactions,
+	receipts types.Receipts,
+) *types.Header {
+	numBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(numBuf, blockNum)
+	gasUsed := uint64(0)
+	if len(receipts) > 0 {
+		gasUsed = receipts[len(receipts)-1].CumulativeGasUsed
+	}
+	gasLimit := uint64(blockGasLimit)
+	if gasUsed > gasLimit {
+		gasLimit = gasUsed
+	}
 	return &types.Header{
-		ParentHash:  common.Hash([32]byte{}),
+		ParentHash:  parentHash,
 		UncleHash:   types.EmptyUncleHash,
 		Coinbase:    common.Address([20]byte{}),
 		Root:        common.Hash([32]byte{}),
-		TxHash:      types.EmptyRootHash,
-		ReceiptHash: common.Hash([32]byte{}),
-		Bloom:       types.Bloom{},
+		TxHash:      types.DeriveSha(txs),
+		ReceiptHash: types.DeriveSha(receipts),
+		Bloom:       types.CreateBloom(receipts),
 		Difficulty:  big.NewInt(20),
 		Number:      big.NewInt(int64(blockNum)),
-		GasLimit:    100,
-		GasUsed:     100,
-		Time:        uint64(time.Now().Unix()),
+		GasLimit:    gasLimit,
+		GasUsed:     gasUsed,
+		Time:        timestamp,
 		Extra:       []byte("hello world"),
+		MixDigest:   common.Hash(hashutil.HashKeccak256(append(append([]byte{}, seed...), numBuf...))),
+	}
+}
+
+// DepositReceipts returns the receipts of the deposit transactions included in a block,
+// in order, each of which emits the deposit log at the same position. Deposits never
+// fail, and their transaction uses all of its gas.
+func DepositReceipts(txs []*types.Transaction, logs []types.Log) types.Receipts {
+	receipts := make(types.Receipts, len(txs))
+	cumulativeGasUsed := uint64(0)
+	for i, tx := range txs {
+		cumulativeGasUsed += tx.Gas()
+		l := logs[i]
+		receipt := &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: cumulativeGasUsed,
+			Logs:              []*types.Log{&l},
+			TxHash:            tx.Hash(),
+			GasUsed:           tx.Gas(),
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts[i] = receipt
 	}
+	return receipts
 }
 
 // DepositEventLogs returns a list of eth1 logs that have occurred
 // at a deposit contract address. This uses an internal list of deposit data
 // to return instead of relying on a real network and parsing a real deposit contract
 // for this information.
-func DepositEventLogs(deposits []*DepositData) ([]types.Log, error) {
-	depositEventHash := hashutil.HashKeccak256(depositEventSignature)
+func DepositEventLogs(deposits []*DepositData, contract common.Address) ([]types.Log, error) {
 	logs := make([]types.Log, len(deposits))
 	for i := 0; i < len(logs); i++ {
-		indexBuf := make([]byte, 8)
-		amountBuf := make([]byte, 8)
-		binary.LittleEndian.PutUint64(amountBuf, deposits[i].Amount)
-		binary.LittleEndian.PutUint64(indexBuf, uint64(i))
-		depositLog, err := packDepositLog(
-			deposits[i].Pubkey,
-			deposits[i].WithdrawalCredentials,
-			amountBuf,
-			deposits[i].Signature,
-			indexBuf,
-		)
+		l, err := DepositEventLog(deposits[i], uint64(i), contract)
 		if err != nil {
-			return nil, nil
-		}
-		logs[i] = types.Log{
-			Address: common.Address([20]byte{}),
-			Topics:  []common.Hash{depositEventHash},
-			Data:    depositLog,
-			TxHash:  common.Hash([32]byte{}),
-			TxIndex: 100,
-			Index:   10,
+			return nil, err
 		}
+		logs[i] = l
 	}
 	return logs, nil
 }
+
+// DepositEventLog returns the eth1 log emitted by the deposit contract at the given
+// address for the deposit at the given index of the deposit tree. The transaction and
+// block of the log are left to be filled in by the chain including it.
+func DepositEventLog(deposit *DepositData, index uint64, contract common.Address) (types.Log, error) {
+	depositEventHash := hashutil.HashKeccak256(depositEventSignature)
+	indexBuf := make([]byte, 8)
+	amountBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(amountBuf, deposit.Amount)
+	binary.LittleEndian.PutUint64(indexBuf, index)
+	depositLog, err := packDepositLog(
+		deposit.Pubkey,
+		deposit.WithdrawalCredentials,
+		amountBuf,
+		deposit.Signature,
+		indexBuf,
+	)
+	if err != nil {
+		return types.Log{}, err
+	}
+	return types.Log{
+		Address: contract,
+		Topics:  []common.Hash{depositEventHash},
+		Data:    depositLog,
+	}, nil
+}
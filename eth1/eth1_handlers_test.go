@@ -3,12 +3,15 @@ package eth1
 import (
 	"testing"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func TestConstructBlocksByNumber(t *testing.T) {
 	num := uint64(5)
 	blockTime := time.Second
-	res := ConstructBlocksByNumber(num, blockTime)
+	res := ConstructBlocksByNumber(num, 1000, blockTime, []byte("seed"))
 	numKeys := uint64(0)
 	currBlock := res[num]
 	for _, v := range res {
@@ -19,7 +22,71 @@ func TestConstructBlocksByNumber(t *testing.T) {
 		}
 		numKeys++
 	}
-	if numKeys != num {
-		t.Errorf("Expected %d keys, received %d", num, numKeys)
+	if numKeys != num+1 {
+		t.Errorf("Expected %d keys, received %d", num+1, numKeys)
+	}
+}
+
+func TestConstructBlocksByNumber_LinksParentHashes(t *testing.T) {
+	num := uint64(5)
+	res := ConstructBlocksByNumber(num, 1000, time.Second, []byte("seed"))
+	for i := uint64(1); i <= num; i++ {
+		if res[i].ParentHash != res[i-1].Hash() {
+			t.Errorf("Expected block %d to have parent hash %#x, received %#x", i, res[i-1].Hash(), res[i].ParentHash)
+		}
+	}
+}
+
+func TestConstructBlocksByNumber_Deterministic(t *testing.T) {
+	num := uint64(5)
+	first := ConstructBlocksByNumber(num, 1000, time.Second, []byte("seed"))
+	second := ConstructBlocksByNumber(num, 1000, time.Second, []byte("seed"))
+	if first[num].Hash() != second[num].Hash() {
+		t.Error("Expected chains built from the same seed and genesis time to have the same head")
+	}
+	other := ConstructBlocksByNumber(num, 1000, time.Second, []byte("other seed"))
+	if first[num].Hash() == other[num].Hash() {
+		t.Error("Expected chains built from different seeds to have different heads")
+	}
+}
+
+func TestBlockHeader_DepositTransactions(t *testing.T) {
+	empty := BlockHeader(1, common.Hash{}, 1000, []byte("seed"), nil, nil)
+	if empty.TxHash != types.EmptyRootHash || empty.ReceiptHash != types.EmptyRootHash {
+		t.Error("Expected a block without transactions to have empty transactions and receipts roots")
+	}
+	if empty.Bloom != (types.Bloom{}) {
+		t.Error("Expected a block without logs to have an empty logs bloom")
+	}
+
+	deposits := []*DepositData{testDepositData(t, MaxEffectiveBalance)}
+	contract := common.HexToAddress("0x4242424242424242424242424242424242424242")
+	txs, err := DepositTransactions(deposits, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := DepositEventLogs(deposits, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts := DepositReceipts(txs, logs)
+	header := BlockHeader(1, common.Hash{}, 1000, []byte("seed"), txs, receipts)
+	if header.TxHash != types.DeriveSha(types.Transactions(txs)) {
+		t.Errorf("Expected transactions root %#x, received %#x", types.DeriveSha(types.Transactions(txs)), header.TxHash)
+	}
+	if header.ReceiptHash != types.DeriveSha(receipts) {
+		t.Errorf("Expected receipts root %#x, received %#x", types.DeriveSha(receipts), header.ReceiptHash)
+	}
+	if !types.BloomLookup(header.Bloom, logs[0].Topics[0]) || !types.BloomLookup(header.Bloom, logs[0].Address) {
+		t.Error("Expected the logs bloom to contain the address and topic of the deposit log")
+	}
+	if empty.GasUsed != 0 || empty.GasLimit != blockGasLimit {
+		t.Errorf("Expected a block without transactions to use no gas out of %d, received %d out of %d", blockGasLimit, empty.GasUsed, empty.GasLimit)
+	}
+	if header.GasUsed != txs[0].Gas() || header.GasLimit < header.GasUsed {
+		t.Errorf("Expected the block to use the gas %d of its transaction within its limit, received %d out of %d", txs[0].Gas(), header.GasUsed, header.GasLimit)
+	}
+	if header.Hash() == empty.Hash() {
+		t.Error("Expected blocks with different transactions to have different hashes")
 	}
 }
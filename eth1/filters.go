@@ -0,0 +1,67 @@
+package eth1
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FilterLogs returns the subset of logs which fall within the inclusive block range
+// [fromBlock, toBlock], were emitted by one of the given addresses, and match the given
+// topics. An empty list of addresses matches any address. Each position in topics
+// is a set of alternatives, where an empty set acts as a wildcard for that position,
+// mirroring the semantics of eth_getLogs in go-ethereum.
+func FilterLogs(
+	logs []types.Log,
+	fromBlock uint64,
+	toBlock uint64,
+	addresses []common.Address,
+	topics [][]common.Hash,
+) []types.Log {
+	filtered := make([]types.Log, 0)
+	for _, l := range logs {
+		if l.BlockNumber < fromBlock || l.BlockNumber > toBlock {
+			continue
+		}
+		if len(addresses) > 0 && !includesAddress(addresses, l.Address) {
+			continue
+		}
+		if !matchesTopics(l.Topics, topics) {
+			continue
+		}
+		filtered = append(filtered, l)
+	}
+	return filtered
+}
+
+func includesAddress(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTopics checks if a log's topics satisfy a filter's topic criteria, where
+// every position of the criteria is an OR-set of acceptable hashes.
+func matchesTopics(logTopics []common.Hash, topics [][]common.Hash) bool {
+	if len(topics) > len(logTopics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range sub {
+			if logTopics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
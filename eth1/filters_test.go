@@ -0,0 +1,94 @@
+package eth1
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFilterLogs(t *testing.T) {
+	addr := common.HexToAddress("0x1234")
+	otherAddr := common.HexToAddress("0x5678")
+	topicA := common.HexToHash("0xaa")
+	topicB := common.HexToHash("0xbb")
+	topicC := common.HexToHash("0xcc")
+	logs := []types.Log{
+		{Address: addr, Topics: []common.Hash{topicA}, BlockNumber: 10},
+		{Address: addr, Topics: []common.Hash{topicA, topicB}, BlockNumber: 11},
+		{Address: otherAddr, Topics: []common.Hash{topicB}, BlockNumber: 12},
+		{Address: addr, Topics: []common.Hash{topicC, topicB}, BlockNumber: 13},
+	}
+	tests := []struct {
+		name      string
+		from      uint64
+		to        uint64
+		addresses []common.Address
+		topics    [][]common.Hash
+		want      []uint64
+	}{
+		{
+			name: "block range only",
+			from: 11,
+			to:   12,
+			want: []uint64{11, 12},
+		},
+		{
+			name:      "address filter",
+			from:      0,
+			to:        20,
+			addresses: []common.Address{otherAddr},
+			want:      []uint64{12},
+		},
+		{
+			name:   "single topic",
+			from:   0,
+			to:     20,
+			topics: [][]common.Hash{{topicA}},
+			want:   []uint64{10, 11},
+		},
+		{
+			name:   "wildcard followed by topic",
+			from:   0,
+			to:     20,
+			topics: [][]common.Hash{nil, {topicB}},
+			want:   []uint64{11, 13},
+		},
+		{
+			name:   "or-set of topics",
+			from:   0,
+			to:     20,
+			topics: [][]common.Hash{{topicB, topicC}},
+			want:   []uint64{12, 13},
+		},
+		{
+			name:   "more topics than log has",
+			from:   0,
+			to:     20,
+			topics: [][]common.Hash{nil, nil, nil},
+			want:   []uint64{},
+		},
+		{
+			name: "empty range",
+			from: 14,
+			to:   13,
+			want: []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := FilterLogs(logs, tt.from, tt.to, tt.addresses, tt.topics)
+			if res == nil {
+				t.Fatal("Expected a non-nil list of logs")
+			}
+			if len(res) != len(tt.want) {
+				t.Fatalf("Expected %d logs, received %d", len(tt.want), len(res))
+			}
+			for i, l := range res {
+				if l.BlockNumber != tt.want[i] {
+					t.Errorf("Expected log at block %d, received %d", tt.want[i], l.BlockNumber)
+				}
+			}
+		})
+	}
+}
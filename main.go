@@ -3,76 +3,48 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/hex"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
-	"net/http"
 	"os"
-	"path"
-	"reflect"
+	"os/signal"
 	"strconv"
-	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/event"
-	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/pkg/profile"
-	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+	"github.com/prysmaticlabs/eth1-mock-rpc/server"
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
-	"golang.org/x/net/websocket"
-)
-
-const (
-	maxRequestContentLength = 1024 * 512
-	defaultErrorCode        = -32000
-	eth1BlockTime           = time.Second * 10
-	startingBlockNumber     = 2000
 )
 
 var (
 	wsPort             = flag.String("ws-port", "7778", "Port on which to serve websocket listeners")
 	httpPort           = flag.String("http-port", "7777", "Port on which to serve http listeners")
+	adminPort          = flag.String("admin-port", "7779", "Port on which to serve the http admin API")
 	host               = flag.String("host", "localhost", "Host on which to listen (default: localhost)")
 	numGenesisDeposits = flag.Int("genesis-deposits", 0, "Number of deposits to read from the keystore to trigger the genesis event")
 	blockTime          = flag.Int("block-time", 14, "Average time between blocks in seconds, default: 14s (Goerli testnet)")
+	mining             = flag.String("mining", "interval", "Block production mode: interval (every --block-time), manual (on evm_mine or admin requests only), on-deposit (as soon as deposits are queued)")
 	verbosity          = flag.String("verbosity", "info", "Logging verbosity (debug, info=default, warn, error, fatal, panic)")
 	pprof              = flag.Bool("pprof", false, "Enable pprof")
 	unencryptedKeysDir = flag.String("unencrypted-keys-dir", "", "Path to directory of json files containing unencrypted validator private keys")
+	maxLogsPerQuery    = flag.Int("max-logs-per-query", 10000, "Maximum number of logs returned by a single eth_getLogs request")
+	chainID            = flag.Uint64("chain-id", 5, "Chain ID returned by eth_chainId, default: 5 (Goerli testnet)")
+	networkID          = flag.Uint64("network-id", 0, "Network ID returned by net_version, defaults to the --chain-id")
+	genesisTimestamp   = flag.Uint64("genesis-timestamp", 0, "Unix timestamp of eth1 block 0, defaults to a history ending at the current time")
+	seed               = flag.String("seed", "", "Seed from which the hashes of the mock eth1 chain are derived")
+	depositContract    = flag.String("deposit-contract", "0x4242424242424242424242424242424242424242", "Address of the deposit contract emitting the deposit logs")
+	dataDir            = flag.String("datadir", "", "Directory to which the chain is persisted and from which it is resumed on restart, the chain is only kept in memory if empty")
+	shutdownTimeout    = flag.Duration("shutdown-timeout", 5*time.Second, "Time to wait for in-flight requests to complete when shutting down")
 	log                = logrus.WithField("prefix", "main")
 	// use this flag when running non-interactively
 	// otherwise, prompt will spam stdout
-	promptForDeposits  = flag.Bool("prompt-for-deposits", true, "Prompt user to trigger deposits")
+	promptForDeposits = flag.Bool("prompt-for-deposits", true, "Prompt user to trigger deposits")
 )
 
-type server struct {
-	depositsLock           sync.Mutex
-	numDepositsReadyToSend int
-	deposits               []*eth1.DepositData
-	eth1BlocksByNumber     map[uint64]*types.Header
-	eth1BlockNumbersByHash map[common.Hash]uint64
-	eth1Logs               []types.Log
-	eth1BlockNum           uint64
-	depositsToSend         int
-	eth1HeadFeed           *event.Feed
-	genesisTime            uint64
-}
-
-type websocketHandler struct {
-	blockNum      uint64
-	close         chan bool
-	readOperation chan []*jsonrpcMessage // Channel for read messages from the codec.
-	readErr       chan error
-}
-
 func main() {
 	flag.Parse()
 	formatter := new(prefixed.TextFormatter)
@@ -85,353 +57,90 @@ func main() {
 	}
 	logrus.SetLevel(level)
 
-	if *numGenesisDeposits == 0 {
-		log.Fatal("Please enter a valid number of --genesis-deposits to read from the keystore")
-	}
+	// The deposits of a chain persisted to the data directory are resumed along with
+	// it, so the keystore is only needed to start a new chain.
+	var validatorKeys, withdrawalKeys [][]byte
+	if !server.HasPersistedChain(*dataDir) {
+		if *numGenesisDeposits == 0 {
+			log.Fatal("Please enter a valid number of --genesis-deposits to read from the keystore")
+		}
 
-	// If an unencrypted keys directory is not specified, we throw an error
-	providedUnencryptedKeys := *unencryptedKeysDir != ""
-	if !providedUnencryptedKeys {
-		log.Fatal("Please enter a path to a directory of unencrypted private key JSON files for launching the mock server")
-	}
-	fileInfo, err := ioutil.ReadDir(*unencryptedKeysDir)
-	if err != nil {
-		log.Fatal(err)
-	}
-	validatorKeys := make([][]byte, 0)
-	withdrawalKeys := make([][]byte, 0)
-	for _, file := range fileInfo {
-		r, err := os.Open(path.Join(*unencryptedKeysDir, file.Name()))
-		if err != nil {
-			log.Fatal(err)
+		// If an unencrypted keys directory is not specified, we throw an error
+		providedUnencryptedKeys := *unencryptedKeysDir != ""
+		if !providedUnencryptedKeys {
+			log.Fatal("Please enter a path to a directory of unencrypted private key JSON files for launching the mock server")
 		}
-		vkey, wkey, err := parseUnencryptedKeysFile(r)
+		validatorKeys, withdrawalKeys, err = server.LoadUnencryptedKeys(*unencryptedKeysDir)
 		if err != nil {
 			log.Fatal(err)
 		}
-		validatorKeys = append(validatorKeys, vkey...)
-		withdrawalKeys = append(withdrawalKeys, wkey...)
-	}
-	allDeposits, err := createDepositDataFromKeys(validatorKeys, withdrawalKeys)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if *numGenesisDeposits > len(allDeposits) {
-		log.Fatalf(
-			"Number of --genesis-deposits %d > number of deposits found in keystore directory %d",
-			*numGenesisDeposits,
-			allDeposits,
-		)
 	}
 
-	httpListener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", *host, *httpPort))
-	if err != nil {
-		log.Fatal(err)
-	}
-	wsListener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", *host, *wsPort))
+	if !common.IsHexAddress(*depositContract) {
+		log.Fatalf("Invalid --deposit-contract address %q", *depositContract)
+	}
+
+	srv, err := server.New(&server.Config{
+		ValidatorKeys:    validatorKeys,
+		WithdrawalKeys:   withdrawalKeys,
+		GenesisDeposits:  *numGenesisDeposits,
+		BlockTime:        *blockTime,
+		Mining:           server.MiningMode(*mining),
+		HTTPAddr:         net.JoinHostPort(*host, *httpPort),
+		WSAddr:           net.JoinHostPort(*host, *wsPort),
+		AdminAddr:        net.JoinHostPort(*host, *adminPort),
+		ChainID:          *chainID,
+		NetworkID:        *networkID,
+		GenesisTimestamp: *genesisTimestamp,
+		Seed:             []byte(*seed),
+		DepositContract:  common.HexToAddress(*depositContract),
+		DataDir:          *dataDir,
+		MaxLogsPerQuery:  *maxLogsPerQuery,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// We also compute a history of eth1 blocks to be used to respond to RPC requests for
-	// blocks by number, getting our mock server to closely resemble a real chain.
-	currentBlockNumber := uint64(startingBlockNumber)
-	blocksByNumber := eth1.ConstructBlocksByNumber(currentBlockNumber, eth1BlockTime)
-	blockNumbersByHash := make(map[common.Hash]uint64)
-	for k, v := range blocksByNumber {
-		h := v.Hash()
-		blockNumbersByHash[h] = k
+	// The profile is flushed when main returns after a graceful shutdown, so we keep
+	// the profiler from installing its own signal handler.
+	if *pprof {
+		defer profile.Start(profile.NoShutdownHook).Stop()
 	}
 
-	// We precalculate a list of deposit logs from the entire in-memory deposits list.
-	logs, err := eth1.DepositEventLogs(allDeposits)
-	if err != nil {
+	if err := srv.Start(context.Background()); err != nil {
 		log.Fatal(err)
 	}
 
-	for i := 0; i < *numGenesisDeposits; i++ {
-		logs[i].BlockHash = blocksByNumber[currentBlockNumber].Hash()
-		logs[i].BlockNumber = currentBlockNumber
-	}
-
-	srv := &server{
-		numDepositsReadyToSend: *numGenesisDeposits,
-		deposits:               allDeposits,
-		eth1Logs:               logs,
-		eth1BlockNum:           currentBlockNumber,
-		eth1BlockNumbersByHash: blockNumbersByHash,
-		eth1BlocksByNumber:     blocksByNumber,
-		eth1HeadFeed:           new(event.Feed),
-		genesisTime:            uint64(time.Now().Add(10 * time.Second).Unix()),
-	}
-
-	if *pprof {
-		defer profile.Start().Stop()
-	}
-
-	log.Println("Starting HTTP listener on port :7777")
-	go http.Serve(httpListener, srv)
-
-	log.Println("Starting WebSocket listener on port :7778")
-	wsSrv := &http.Server{Handler: srv.ServeWebsocket()}
-	go wsSrv.Serve(wsListener)
-
 	if *promptForDeposits {
-		go srv.listenForDepositTrigger()
-	}
-
-	go srv.advanceEth1Chain(*blockTime)
-
-	select {}
-}
-
-func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	body := io.LimitReader(r.Body, maxRequestContentLength)
-	conn := &httpServerConn{Reader: body, Writer: w, r: r}
-	codec := NewJSONCodec(conn)
-	defer codec.Close()
-	msgs, batch, err := codec.Read()
-	if err != nil {
-		log.WithError(err).Error("Could not read data from request")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	requestItem := msgs[0]
-	if !requestItem.isCall() {
-		log.WithField("messageType", requestItem.Method).Error("Can only serve RPC call types via HTTP")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	stringRep := requestItem.String()
-	switch requestItem.Method {
-	case "eth_getBlockByNumber":
-		blocks := make([]*types.Header, 0)
-		for i := 0; i < len(msgs); i++ {
-			typs := []reflect.Type{
-				reflect.TypeOf("s"),
-				reflect.TypeOf(true),
-			}
-			args, err := parsePositionalArguments(requestItem.Params, typs)
-			if err != nil {
-				log.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-
-			var block *types.Header
-			var ok bool
-			if args[0].String() == "latest" {
-				block, ok = s.eth1BlocksByNumber[s.eth1BlockNum]
-				if !ok {
-					log.Errorf("Block with 'latest' does not exist at blocknumber %d", s.eth1BlockNum)
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-			} else {
-				num, err := hexutil.DecodeBig(args[0].String())
-				if err != nil {
-					log.Error(err)
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-				if num.Uint64() < startingBlockNumber {
-					num = num.SetInt64(startingBlockNumber)
-				}
-				block, ok = s.eth1BlocksByNumber[num.Uint64()]
-				if !ok {
-					log.Errorf("Block %d does not exist", num.Uint64())
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-			}
-			blocks = append(blocks, block)
-		}
-		if len(blocks) == 1 && !batch {
-			response := requestItem.response(blocks[0])
-			if err := codec.Write(ctx, response); err != nil {
-				log.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-		responses := make([]*jsonrpcMessage, 0)
-		for i, b := range blocks {
-			res := msgs[i].response(b)
-			responses = append(responses, res)
-		}
-		if err := codec.Write(ctx, responses); err != nil {
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-	case "eth_getBlockByHash":
-		typs := []reflect.Type{
-			reflect.TypeOf("s"),
-			reflect.TypeOf(true),
-		}
-		args, err := parsePositionalArguments(requestItem.Params, typs)
-		if err != nil {
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		h := args[0].String()
-		// Strip out the 0x prefix.
-		blockHashBytes, err := hex.DecodeString(h[2:])
-		if err != nil {
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		var blockHash [32]byte
-		copy(blockHash[:], blockHashBytes)
-		numByHash := s.eth1BlockNumbersByHash[blockHash]
-		if numByHash < startingBlockNumber {
-			numByHash = startingBlockNumber
-		}
-		block := s.eth1BlocksByNumber[numByHash]
-		response := requestItem.response(block)
-		if err := codec.Write(ctx, response); err != nil {
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-	case "eth_getLogs":
-		response := requestItem.response(s.eth1Logs[:s.numDepositsReadyToSend])
-		if err := codec.Write(ctx, response); err != nil {
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-	case "eth_call":
-		if strings.Contains(stringRep, eth1.DepositMethodID()) {
-			count := eth1.DepositCount(s.deposits[:s.numDepositsReadyToSend])
-			depCount, err := eth1.PackDepositCount(count[:])
-			if err != nil {
-				log.WithError(err).Error("Could not respond to HTTP request")
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			response := requestItem.response(fmt.Sprintf("%#x", depCount))
-			if err := codec.Write(ctx, response); err != nil {
-				log.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-		if strings.Contains(stringRep, eth1.DepositLogsID()) {
-			root, err := eth1.DepositRoot(s.deposits[:s.numDepositsReadyToSend])
-			if err != nil {
-				log.WithError(err).Error("Could not respond to HTTP request")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			response := requestItem.response(fmt.Sprintf("%#x", root))
-			if err := codec.Write(ctx, response); err != nil {
-				log.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-		s.defaultResponse(w)
-	default:
-		s.defaultResponse(w)
+		go listenForDepositTrigger(srv)
 	}
-}
-
-func (s *server) defaultResponse(w http.ResponseWriter) {
-	log.Error("Could not respond to HTTP request")
-	w.WriteHeader(http.StatusBadRequest)
-}
 
-func (s *server) ServeWebsocket() http.Handler {
-	return websocket.Server{
-		Handler: func(conn *websocket.Conn) {
-			codec := newWebsocketCodec(conn)
-			wsHandler := &websocketHandler{
-				blockNum:      0,
-				close:         make(chan bool),
-				readOperation: make(chan []*jsonrpcMessage),
-				readErr:       make(chan error),
-			}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigc
+	log.WithField("signal", sig).Info("Shutting down")
+	signal.Stop(sigc)
 
-			defer codec.Close()
-			// Listen to read events from the codec and dispatch events or errors accordingly.
-			go wsHandler.websocketReadLoop(codec)
-			go wsHandler.dispatchWebsocketEventLoop(codec, s.eth1HeadFeed)
-			<-codec.Closed()
-		},
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Could not shut down gracefully")
 	}
 }
 
-func (w *websocketHandler) dispatchWebsocketEventLoop(codec ServerCodec, headFeed *event.Feed) {
-	var latestSubID rpc.ID
-	headChan := make(chan *types.Header, 1)
-	sub := headFeed.Subscribe(headChan)
-	defer sub.Unsubscribe()
-	for {
-		select {
-		case <-w.close:
-			return
-		case err := <-w.readErr:
-			log.WithError(err).Error("Could not read data from request")
-			return
-		case head := <-headChan:
-			data, _ := json.Marshal(head)
-			params, _ := json.Marshal(&subscriptionResult{ID: string(latestSubID), Result: data})
-			ctx := context.Background()
-			item := &jsonrpcMessage{
-				Version: "2.0",
-				Method:  "eth_subscription",
-				Params:  params,
-			}
-			if err := codec.Write(ctx, item); err != nil {
-				log.Error(err)
-				continue
-			}
-		case msgs := <-w.readOperation:
-			sub := &rpc.Subscription{ID: rpc.NewID()}
-			item := &jsonrpcMessage{
-				Version: msgs[0].Version,
-				ID:      msgs[0].ID,
-			}
-			latestSubID = sub.ID
-			newItem := item.response(sub)
-			if err := codec.Write(context.Background(), newItem); err != nil {
-				log.Error(err)
-				continue
-			}
-		}
-	}
-}
-
-func (w *websocketHandler) websocketReadLoop(codec ServerCodec) {
-	for {
-		select {
-		case <-w.close:
-			return
-		default:
-			msgs, _, err := codec.Read()
-			if _, ok := err.(*json.SyntaxError); ok {
-				if err := codec.Write(context.Background(), errorMessage(err)); err != nil {
-					log.Error(err)
-					continue
-				}
-			}
-			if err != nil {
-				w.readErr <- err
-				return
-			}
-			w.readOperation <- msgs
-		}
-	}
-}
-
-func (s *server) listenForDepositTrigger() {
+func listenForDepositTrigger(srv *server.Server) {
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		maxAllowed := len(s.deposits) - s.numDepositsReadyToSend
 		log.Printf(
 			"Enter the number of new eth2 deposits to trigger (max allowed %d): ",
-			maxAllowed,
+			srv.DepositStatus().Available,
 		)
 		fmt.Print(">> ")
 		line, _, err := reader.ReadLine()
+		if err == io.EOF {
+			log.Info("Stopped prompting for deposits as stdin is closed")
+			return
+		}
 		if err != nil {
 			log.Error(err)
 			continue
@@ -439,39 +148,10 @@ func (s *server) listenForDepositTrigger() {
 		num, err := strconv.Atoi(string(line))
 		if err != nil {
 			log.Error(err)
-		}
-		if num > maxAllowed {
-			log.Errorf(
-				"You have already sent %d/%d available deposits in keystore, cannot submit more",
-				len(s.deposits),
-				s.numDepositsReadyToSend,
-			)
 			continue
 		}
-		s.depositsToSend = num
-		for s.depositsToSend != 0 {
-			time.Sleep(1 * time.Second)
-			// wait till it's sent again
-		}
-	}
-}
-
-func (s *server) advanceEth1Chain(blockTime int) {
-	tick := time.NewTicker(time.Second * time.Duration(blockTime))
-	for {
-		select {
-		case <-tick.C:
-			s.eth1BlockNum++
-			head := eth1.BlockHeader(s.eth1BlockNum)
-			s.eth1BlocksByNumber[s.eth1BlockNum] = head
-			s.eth1BlockNumbersByHash[head.Hash()] = s.eth1BlockNum
-			for i := s.numDepositsReadyToSend; i < (s.numDepositsReadyToSend + s.depositsToSend); i++ {
-				s.eth1Logs[i].BlockHash = s.eth1BlocksByNumber[s.eth1BlockNum].Hash()
-				s.eth1Logs[i].BlockNumber = s.eth1BlockNum
-			}
-			s.numDepositsReadyToSend += s.depositsToSend
-			s.depositsToSend = 0
-			s.eth1HeadFeed.Send(head)
+		if err := srv.QueueDeposits(num); err != nil {
+			log.Error(err)
 		}
 	}
 }
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DepositStatus reports the progress of the deposits from the keystore.
+type DepositStatus struct {
+	Total     int `json:"total"`
+	Included  int `json:"included"`
+	Pending   int `json:"pending"`
+	Available int `json:"available"`
+}
+
+type minedBlock struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	Time   uint64      `json:"time"`
+}
+
+type pauseStatus struct {
+	Paused bool `json:"paused"`
+}
+
+type blockTimeStatus struct {
+	BlockTime int `json:"blockTime"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// adminHandler serves the JSON admin API used to drive the mock chain programmatically,
+// as an alternative to the interactive deposit prompt.
+//
+//   GET  /deposits    returns the status of the deposits from the keystore
+//   POST /deposits    queues {"count": N} deposits for the next block
+//   POST /mine        produces {"blocks": N, "timestamp": T} blocks immediately, one by default
+//   POST /pause       pauses block production
+//   POST /resume      resumes block production
+//   POST /block-time  sets the time between blocks to {"seconds": N}
+//   GET  /deposit-proof?index=I&block=N
+//                     returns the Merkle proof of deposit I as of block N, the head by default
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deposits", s.handleDeposits)
+	mux.HandleFunc("/mine", s.handleMine)
+	mux.HandleFunc("/pause", s.handlePause(true))
+	mux.HandleFunc("/resume", s.handlePause(false))
+	mux.HandleFunc("/block-time", s.handleBlockTime)
+	mux.HandleFunc("/deposit-proof", s.handleDepositProof)
+	return mux
+}
+
+func (s *Server) handleDeposits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Count int `json:"count"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.QueueDeposits(req.Count); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.WithField("count", req.Count).Info("Queued deposits for the next block")
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeAdminResponse(w, s.chain.depositStatus())
+}
+
+func (s *Server) handleMine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	opts := mineOptions{Blocks: 1}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.Blocks == 0 {
+		opts.Blocks = 1
+	}
+	heads, err := s.MineBlocks(opts.Blocks, opts.Timestamp)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	head := heads[len(heads)-1]
+	writeAdminResponse(w, &minedBlock{
+		Number: head.Number.Uint64(),
+		Hash:   head.Hash(),
+		Time:   head.Time,
+	})
+}
+
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		s.pauseRequests <- paused
+		writeAdminResponse(w, &pauseStatus{Paused: paused})
+	}
+}
+
+func (s *Server) handleBlockTime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	var req struct {
+		Seconds int `json:"seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Seconds <= 0 {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("block time must be positive, received %d", req.Seconds))
+		return
+	}
+	s.blockTimeRequests <- req.Seconds
+	writeAdminResponse(w, &blockTimeStatus{BlockTime: req.Seconds})
+}
+
+func (s *Server) handleDepositProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	query := r.URL.Query()
+	index, err := strconv.ParseUint(query.Get("index"), 10, 64)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid deposit index: %v", err))
+		return
+	}
+	var blockNrOrHash *rpc.BlockNumberOrHash
+	if block := query.Get("block"); block != "" {
+		num, err := strconv.ParseUint(block, 10, 64)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid block number: %v", err))
+			return
+		}
+		b := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(num))
+		blockNrOrHash = &b
+	}
+	proof, err := s.chain.depositProof(index, blockNrOrHash)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAdminResponse(w, proof)
+}
+
+func writeAdminResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Could not write admin response")
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	log.WithError(err).Error("Could not serve admin request")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&adminError{Error: err.Error()}); err != nil {
+		log.WithError(err).Error("Could not write admin response")
+	}
+}
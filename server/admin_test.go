@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// adminRequest sends a request to the admin API of a server, decoding a successful
+// response into v.
+func adminRequest(t *testing.T, srv *Server, method string, path string, body string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	srv.adminHandler().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK && v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("Could not decode the response of %s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestServer_AdminAPI(t *testing.T) {
+	srv, err := newServer(&Config{
+		GenesisDeposits: 1,
+		Mining:          OnDepositMining,
+	}, testDeposits(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headChan := make(chan *types.Header, 4)
+	sub := srv.chain.subscribeNewHeads(headChan)
+	defer sub.Unsubscribe()
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	status := new(DepositStatus)
+	if code := adminRequest(t, srv, http.MethodGet, "/deposits", "", status); code != http.StatusOK {
+		t.Fatalf("Expected status 200 getting the deposits, received %d", code)
+	}
+	if status.Total != 4 || status.Included != 1 || status.Available != 3 {
+		t.Errorf("Unexpected deposit status %+v", status)
+	}
+	if code := adminRequest(t, srv, http.MethodPut, "/deposits", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 putting deposits, received %d", code)
+	}
+	for _, body := range []string{`{"count":"one"}`, `{"count":10}`} {
+		if code := adminRequest(t, srv, http.MethodPost, "/deposits", body, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 queueing deposits with %s, received %d", body, code)
+		}
+	}
+
+	// Deposits queued while block production is paused are included as soon as it
+	// resumes.
+	paused := new(pauseStatus)
+	if code := adminRequest(t, srv, http.MethodPost, "/pause", "", paused); code != http.StatusOK || !paused.Paused {
+		t.Fatalf("Expected block production to be paused, received status %d: %+v", code, paused)
+	}
+	if code := adminRequest(t, srv, http.MethodPost, "/deposits", `{"count":1}`, status); code != http.StatusOK {
+		t.Fatalf("Expected status 200 queueing deposits, received %d", code)
+	}
+	if status.Pending != 1 || status.Available != 2 {
+		t.Errorf("Expected 1 deposit to be queued, received %+v", status)
+	}
+	expectNoBlock := func() {
+		select {
+		case head := <-headChan:
+			t.Fatalf("Expected no block to be produced, received block %d", head.Number.Uint64())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	expectNoBlock()
+	if code := adminRequest(t, srv, http.MethodPost, "/resume", "", paused); code != http.StatusOK || paused.Paused {
+		t.Fatalf("Expected block production to be resumed, received status %d: %+v", code, paused)
+	}
+	select {
+	case head := <-headChan:
+		if head.Number.Uint64() != startingBlockNumber+1 {
+			t.Errorf("Expected block %d to be produced, received %d", startingBlockNumber+1, head.Number.Uint64())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a block to be produced for the deposits queued while paused")
+	}
+	if status := srv.DepositStatus(); status.Included != 2 || status.Pending != 0 {
+		t.Errorf("Expected the queued deposit to be included once resumed, received %+v", status)
+	}
+
+	mined := new(minedBlock)
+	if code := adminRequest(t, srv, http.MethodPost, "/mine", `{"blocks":2}`, mined); code != http.StatusOK {
+		t.Fatalf("Expected status 200 mining blocks, received %d", code)
+	}
+	if mined.Number != startingBlockNumber+3 || mined.Hash != srv.Head().Hash() {
+		t.Errorf("Expected the new head %d to be returned, received %+v", startingBlockNumber+3, mined)
+	}
+	for i := 0; i < 2; i++ {
+		<-headChan
+	}
+	if code := adminRequest(t, srv, http.MethodGet, "/mine", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 getting /mine, received %d", code)
+	}
+
+	// Deposits queued while paused but mined on request are not mined again on resume.
+	adminRequest(t, srv, http.MethodPost, "/pause", "", nil)
+	if code := adminRequest(t, srv, http.MethodPost, "/deposits", `{"count":1}`, nil); code != http.StatusOK {
+		t.Fatalf("Expected status 200 queueing deposits, received %d", code)
+	}
+	if code := adminRequest(t, srv, http.MethodPost, "/mine", "", mined); code != http.StatusOK || mined.Number != startingBlockNumber+4 {
+		t.Fatalf("Expected block %d to be mined, received status %d: %+v", startingBlockNumber+4, code, mined)
+	}
+	<-headChan
+	adminRequest(t, srv, http.MethodPost, "/resume", "", nil)
+	expectNoBlock()
+	if status := srv.DepositStatus(); status.Included != 3 || status.Pending != 0 {
+		t.Errorf("Expected the deposit to be included in the mined block, received %+v", status)
+	}
+
+	blockTime := new(blockTimeStatus)
+	if code := adminRequest(t, srv, http.MethodPost, "/block-time", `{"seconds":0}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 setting a block time of 0, received %d", code)
+	}
+	if code := adminRequest(t, srv, http.MethodPost, "/block-time", `{"seconds":5}`, blockTime); code != http.StatusOK || blockTime.BlockTime != 5 {
+		t.Errorf("Expected the block time to be updated, received status %d: %+v", code, blockTime)
+	}
+}
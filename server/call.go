@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callArgs represents the call object received as the first parameter of an eth_call
+// request. Only the fields needed to answer calls to the deposit contract are decoded.
+type callArgs struct {
+	To    *common.Address `json:"to"`
+	Data  *hexutil.Bytes  `json:"data"`
+	Input *hexutil.Bytes  `json:"input"`
+}
+
+// data returns the call data of the call, which newer clients send as input and
+// older ones as data, mirroring go-ethereum.
+func (args *callArgs) data() ([]byte, error) {
+	if args.Input != nil && args.Data != nil && !bytes.Equal(*args.Input, *args.Data) {
+		return nil, errors.New(`both "data" and "input" are set and not equal`)
+	}
+	if args.Input != nil {
+		return *args.Input, nil
+	}
+	if args.Data != nil {
+		return *args.Data, nil
+	}
+	return nil, nil
+}
+
+var errHeaderNotFound = errors.New("header not found")
+
+// depositRootAt returns the number of deposits included in the chain at or before the
+// given block, along with the root of their deposit tree.
+func (c *chainStore) depositRootAt(blockNrOrHash *rpc.BlockNumberOrHash) (uint64, [32]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, count, err := c.depositCountAt(blockNrOrHash)
+	if err != nil {
+		return 0, [32]byte{}, err
+	}
+	root, err := c.depositTree.RootAt(count)
+	if err != nil {
+		return 0, [32]byte{}, err
+	}
+	return count, root, nil
+}
+
+// depositCountAt resolves a block identified either by number or by hash as specified
+// by EIP-1898, defaulting to the head, and returns its number along with the number of
+// deposits included at or before it. Block tags other than "earliest" resolve to the
+// head. The caller must hold the lock.
+func (c *chainStore) depositCountAt(blockNrOrHash *rpc.BlockNumberOrHash) (uint64, uint64, error) {
+	num := c.eth1BlockNum
+	if blockNrOrHash != nil {
+		if hash, ok := blockNrOrHash.Hash(); ok {
+			// Only blocks of the current branch are known, so they are all canonical.
+			n, ok := c.eth1BlockNumbersByHash[hash]
+			if !ok {
+				return 0, 0, fmt.Errorf("header for hash %#x not found", hash)
+			}
+			num = n
+		} else if n, ok := blockNrOrHash.Number(); ok && n >= 0 {
+			if uint64(n) > c.eth1BlockNum {
+				return 0, 0, errHeaderNotFound
+			}
+			num = uint64(n)
+		}
+	}
+	included := c.eth1Logs[:c.numDepositsReadyToSend]
+	// Deposits are included in order, so their logs are sorted by block number.
+	count := sort.Search(len(included), func(i int) bool {
+		return included[i].BlockNumber > num
+	})
+	return num, uint64(count), nil
+}
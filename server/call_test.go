@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+func TestServer_CallDepositContract(t *testing.T) {
+	srv := testServer(t, 4, 2)
+	deposits := srv.chain.includedDeposits()
+	root, err := eth1.DepositRoot(deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method   string
+		expected []byte
+	}{
+		{method: "get_deposit_root", expected: root[:]},
+		{method: "get_hash_tree_root", expected: root[:]},
+		{method: "deposit_count", expected: common.LeftPadBytes(big.NewInt(2).Bytes(), 32)},
+		{method: "MIN_DEPOSIT_AMOUNT", expected: common.LeftPadBytes(new(big.Int).SetUint64(eth1.MinDepositAmount).Bytes(), 32)},
+		{method: "drain_address", expected: make([]byte, 32)},
+	}
+	for _, tt := range tests {
+		data, err := eth1.PackDepositContractCall(tt.method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Calls are answered the same way regardless of the field holding the call
+		// data and of the formatting of the call object.
+		for _, params := range []string{
+			fmt.Sprintf(`[{"to":"%s","data":"%#x"},"latest"]`, defaultDepositContract.Hex(), data),
+			fmt.Sprintf(`[{ "input" : "%#x", "to" : "%s" }, "latest"]`, data, defaultDepositContract.Hex()),
+		} {
+			resp := handleRequest(srv, "eth_call", params)
+			if resp.Error != nil {
+				t.Fatalf("Unexpected error calling %s: %v", tt.method, resp.Error)
+			}
+			var res hexutil.Bytes
+			if err := json.Unmarshal(resp.Result, &res); err != nil {
+				t.Fatal(err)
+			}
+			if hexutil.Encode(res) != hexutil.Encode(tt.expected) {
+				t.Errorf("Expected %s to return %#x, received %#x", tt.method, tt.expected, res)
+			}
+		}
+	}
+
+	// The deposit count is returned as little endian bytes.
+	data, err := eth1.PackDepositContractCall("get_deposit_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := handleRequest(srv, "eth_call", fmt.Sprintf(`[{"to":"%s","data":"%#x"},"latest"]`, defaultDepositContract.Hex(), data))
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	var res hexutil.Bytes
+	if err := json.Unmarshal(resp.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 96 || res[64] != 2 {
+		t.Errorf("Expected an ABI encoded deposit count of 2, received %#x", res)
+	}
+
+	resp = handleRequest(srv, "eth_call", fmt.Sprintf(`[{"to":"%s","data":"0xdeadbeef"},"latest"]`, defaultDepositContract.Hex()))
+	if resp.Error == nil || resp.Error.Message != eth1.ErrExecutionReverted.Error() {
+		t.Errorf("Expected an unknown selector to revert, received %s", resp)
+	}
+	resp = handleRequest(srv, "eth_call", fmt.Sprintf(`[{"to":"%s","data":"0x01","input":"0x02"},"latest"]`, defaultDepositContract.Hex()))
+	if resp.Error == nil || resp.Error.Code != (&invalidParamsError{}).ErrorCode() {
+		t.Errorf("Expected an error for conflicting data and input, received %s", resp)
+	}
+}
+
+func TestServer_CallAtBlock(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	first := srv.chain.mineBlock()
+	if err := srv.chain.queueDeposits(3); err != nil {
+		t.Fatal(err)
+	}
+	srv.chain.mineBlock()
+
+	data, err := eth1.PackDepositContractCall("deposit_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callObject := fmt.Sprintf(`{"to":"%s","data":"%#x"}`, defaultDepositContract.Hex(), data)
+	tests := []struct {
+		block    string
+		expected int64
+	}{
+		{block: `"latest"`, expected: 6},
+		{block: `"pending"`, expected: 6},
+		{block: `"earliest"`, expected: 0},
+		{block: fmt.Sprintf(`"%#x"`, startingBlockNumber), expected: 1},
+		{block: fmt.Sprintf(`"%#x"`, first.Number.Uint64()), expected: 3},
+		{block: fmt.Sprintf(`"%s"`, first.Hash().Hex()), expected: 3},
+		{block: fmt.Sprintf(`{"blockNumber":"%#x"}`, first.Number.Uint64()), expected: 3},
+		{block: fmt.Sprintf(`{"blockHash":"%s","requireCanonical":true}`, first.Hash().Hex()), expected: 3},
+	}
+	for _, tt := range tests {
+		resp := handleRequest(srv, "eth_call", fmt.Sprintf(`[%s,%s]`, callObject, tt.block))
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error calling at block %s: %v", tt.block, resp.Error)
+		}
+		var res hexutil.Bytes
+		if err := json.Unmarshal(resp.Result, &res); err != nil {
+			t.Fatal(err)
+		}
+		if count := new(big.Int).SetBytes(res); count.Int64() != tt.expected {
+			t.Errorf("Expected %d deposits at block %s, received %d", tt.expected, tt.block, count)
+		}
+	}
+
+	for _, block := range []string{
+		fmt.Sprintf(`"%#x"`, startingBlockNumber+3),
+		fmt.Sprintf(`{"blockHash":"%s"}`, common.Hash{}.Hex()),
+	} {
+		if resp := handleRequest(srv, "eth_call", fmt.Sprintf(`[%s,%s]`, callObject, block)); resp.Error == nil {
+			t.Errorf("Expected an error calling at unknown block %s", block)
+		}
+	}
+}
+
+func TestChainStore_DepositTree(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	chain := srv.chain
+	checkRoot := func(stage string) {
+		expected, err := eth1.DepositRoot(chain.includedDeposits())
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, root, err := chain.depositRootAt(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != uint64(chain.depositStatus().Included) || root != expected {
+			t.Errorf("Expected root %#x of the included deposits %s, received %#x", expected, stage, root)
+		}
+	}
+
+	if err := chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	checkRoot("after mining")
+	id := chain.snapshot()
+
+	raw := signedDepositTransaction(t, types.HomesteadSigner{}, defaultDepositContract, bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	if _, err := srv.SendRawTransaction(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	checkRoot("after including a deposit transaction")
+	if _, err := chain.reorg(2, reorgOptions{DropDeposits: true}); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot("after dropping deposits in a reorg")
+	chain.mineBlock()
+	checkRoot("after including dropped deposits again")
+	if !chain.revert(id) {
+		t.Fatal("Expected the snapshot to be reverted")
+	}
+	checkRoot("after reverting")
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+// chainStore holds the state of the mock eth1 chain behind a single read/write lock,
+// so it can be read by the HTTP and WebSocket transports while blocks are produced.
+// Feed events are always sent after the lock is released, as subscribers may need to
+// read from the store before they can receive the next event. Every change of the head
+// holds the emit lock until its events are sent, so that subscribers receive the events
+// of concurrent changes in the order the changes were made.
+type chainStore struct {
+	lock                   sync.RWMutex
+	emitLock               sync.Mutex
+	seed                   []byte
+	depositContract        common.Address // Address of the deposit contract, which never changes.
+	deposits               []*eth1.DepositData
+	depositTxs             []*types.Transaction // Transaction which submitted each deposit.
+	txIndicesByHash        map[common.Hash]int  // Index of the deposit of each transaction.
+	depositLeaves          [][32]byte           // Leaf of each deposit in the deposit tree.
+	depositTree            *eth1.DepositTree    // Deposit tree of the included deposits.
+	eth1BlocksByNumber     map[uint64]*types.Header
+	eth1BlockNumbersByHash map[common.Hash]uint64
+	eth1Logs               []types.Log
+	eth1BlockNum           uint64
+	numDepositsReadyToSend int
+	depositsToSend         int
+	numReorgs              uint64
+	clock                  Clock
+	timeOffset             time.Duration             // Offset of the virtual clock of the chain from the clock.
+	nextTimestamp          uint64                    // Timestamp of the next block, or 0 to follow the clock.
+	snapshots              map[uint64]*chainSnapshot // Snapshots by ID, created on the first snapshot.
+	lastSnapshotID         uint64
+	changed                chan struct{} // Notified when the state to be persisted changes.
+	eth1HeadFeed           event.Feed
+	eth1LogsFeed           event.Feed
+}
+
+// newChainStore computes a history of eth1 blocks up to the given head, used to respond
+// to RPC requests for blocks by number, and includes the genesis deposits in the head block.
+// The deposits are made to the deposit contract at the given address. The virtual clock
+// of the chain starts at the timestamp of the head.
+func newChainStore(
+	deposits []*eth1.DepositData,
+	numGenesisDeposits int,
+	headNum uint64,
+	genesisTime uint64,
+	blockTime time.Duration,
+	seed []byte,
+	depositContract common.Address,
+	clock Clock,
+) (*chainStore, error) {
+	if numGenesisDeposits > len(deposits) {
+		return nil, fmt.Errorf(
+			"number of genesis deposits %d > number of deposits found in keystore %d",
+			numGenesisDeposits,
+			len(deposits),
+		)
+	}
+	// We precalculate a list of deposit logs from the entire in-memory deposits list,
+	// each emitted by a synthetic transaction submitting the deposit.
+	txs, err := eth1.DepositTransactions(deposits, depositContract)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := depositLogs(deposits, txs, depositContract)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := eth1.DepositLeaves(deposits)
+	if err != nil {
+		return nil, err
+	}
+
+	// The head block of the history is rebuilt to include the genesis deposits.
+	blocksByNumber := eth1.ConstructBlocksByNumber(headNum, genesisTime, blockTime, seed)
+	head := blocksByNumber[headNum]
+	genesisTxs := txs[:numGenesisDeposits]
+	genesisReceipts := eth1.DepositReceipts(genesisTxs, logs[:numGenesisDeposits])
+	blocksByNumber[headNum] = eth1.BlockHeader(headNum, head.ParentHash, head.Time, seed, genesisTxs, genesisReceipts)
+	blockNumbersByHash := make(map[common.Hash]uint64)
+	for k, v := range blocksByNumber {
+		blockNumbersByHash[v.Hash()] = k
+	}
+	for i := 0; i < numGenesisDeposits; i++ {
+		logs[i].BlockHash = blocksByNumber[headNum].Hash()
+		logs[i].BlockNumber = headNum
+	}
+
+	c := &chainStore{
+		seed:                   seed,
+		depositContract:        depositContract,
+		deposits:               deposits,
+		depositTxs:             txs,
+		txIndicesByHash:        txIndices(txs),
+		depositLeaves:          leaves,
+		depositTree:            depositTree(leaves[:numGenesisDeposits]),
+		eth1BlocksByNumber:     blocksByNumber,
+		eth1BlockNumbersByHash: blockNumbersByHash,
+		eth1Logs:               logs,
+		eth1BlockNum:           headNum,
+		numDepositsReadyToSend: numGenesisDeposits,
+		clock:                  clock,
+		timeOffset:             time.Unix(int64(blocksByNumber[headNum].Time), 0).Sub(clock.Now()),
+		changed:                make(chan struct{}, 1),
+	}
+	c.indexLogs(0)
+	c.markChanged()
+	return c, nil
+}
+
+// depositTree builds the deposit tree of a list of deposits from their leaves.
+func depositTree(leaves [][32]byte) *eth1.DepositTree {
+	tree := eth1.NewDepositTree()
+	for _, leaf := range leaves {
+		tree.Insert(leaf)
+	}
+	return tree
+}
+
+// head returns the latest block of the chain.
+func (c *chainStore) head() *types.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.eth1BlocksByNumber[c.eth1BlockNum]
+}
+
+// blockNumberByHash returns the height of the block with the given hash on the
+// current branch of the chain.
+func (c *chainStore) blockNumberByHash(hash common.Hash) (uint64, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	num, ok := c.eth1BlockNumbersByHash[hash]
+	return num, ok
+}
+
+// filterLogs returns the deposit logs included in the chain so far which match the
+// given criteria.
+func (c *chainStore) filterLogs(crit filterCriteria) ([]types.Log, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var fromBlock, toBlock uint64
+	if crit.BlockHash != nil {
+		num, ok := c.eth1BlockNumbersByHash[*crit.BlockHash]
+		if !ok {
+			return nil, errors.New("unknown block")
+		}
+		fromBlock, toBlock = num, num
+	} else {
+		fromBlock = c.resolveBlockNumber(crit.FromBlock)
+		toBlock = c.resolveBlockNumber(crit.ToBlock)
+	}
+	return eth1.FilterLogs(c.eth1Logs[:c.numDepositsReadyToSend], fromBlock, toBlock, crit.Addresses, crit.Topics), nil
+}
+
+// resolveBlockNumber converts a block number from a request into a height of the mock
+// chain, treating a missing number as well as "latest" and "pending" as the current head.
+// The caller must hold the lock.
+func (c *chainStore) resolveBlockNumber(num *rpc.BlockNumber) uint64 {
+	if num == nil || *num == rpc.LatestBlockNumber || *num == rpc.PendingBlockNumber {
+		return c.eth1BlockNum
+	}
+	return uint64(num.Int64())
+}
+
+// includedDeposits returns the deposits included in the chain so far.
+func (c *chainStore) includedDeposits() []*eth1.DepositData {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.deposits[:c.numDepositsReadyToSend:c.numDepositsReadyToSend]
+}
+
+// depositStatus reports how many deposits from the keystore were included, are queued
+// up for the next block, and are still available.
+func (c *chainStore) depositStatus() *DepositStatus {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return &DepositStatus{
+		Total:     len(c.deposits),
+		Included:  c.numDepositsReadyToSend,
+		Pending:   c.depositsToSend,
+		Available: c.availableDeposits(),
+	}
+}
+
+// availableDeposits returns the number of deposits from the keystore which have
+// neither been included in a block nor queued up for the next one. The caller
+// must hold the lock.
+func (c *chainStore) availableDeposits() int {
+	return len(c.deposits) - c.numDepositsReadyToSend - c.depositsToSend
+}
+
+// queueDeposits queues up a number of deposits from the keystore to be included
+// in the next block produced.
+func (c *chainStore) queueDeposits(num int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if num <= 0 {
+		return fmt.Errorf("number of deposits must be positive, received %d", num)
+	}
+	if maxAllowed := c.availableDeposits(); num > maxAllowed {
+		return fmt.Errorf(
+			"cannot queue %d deposits, only %d/%d deposits in keystore are still available",
+			num,
+			maxAllowed,
+			len(c.deposits),
+		)
+	}
+	c.depositsToSend += num
+	c.markChanged()
+	return nil
+}
+
+// mineBlock appends a new block to the chain at the current time of the virtual clock,
+// including every deposit queued up since the previous block.
+func (c *chainStore) mineBlock() *types.Header {
+	c.emitLock.Lock()
+	defer c.emitLock.Unlock()
+	c.lock.Lock()
+	head, includedLogs := c.appendBlock(c.nextBlockTimestamp())
+	c.lock.Unlock()
+
+	c.notifyBlock(head, includedLogs)
+	return head
+}
+
+// mineBlockAt appends a new block to the chain with the given timestamp, which must
+// be later than the timestamp of its parent.
+func (c *chainStore) mineBlockAt(timestamp uint64) (*types.Header, error) {
+	c.emitLock.Lock()
+	defer c.emitLock.Unlock()
+	c.lock.Lock()
+	parent := c.eth1BlocksByNumber[c.eth1BlockNum]
+	if timestamp <= parent.Time {
+		c.lock.Unlock()
+		return nil, fmt.Errorf("timestamp %d is not after the timestamp %d of the head block", timestamp, parent.Time)
+	}
+	head, includedLogs := c.appendBlock(timestamp)
+	c.lock.Unlock()
+
+	c.notifyBlock(head, includedLogs)
+	return head, nil
+}
+
+// appendBlock appends a new block with the given timestamp on top of the head,
+// returning it along with the deposit logs it includes. The caller must hold the lock.
+func (c *chainStore) appendBlock(timestamp uint64) (*types.Header, []types.Log) {
+	c.catchUpClock(timestamp)
+	if c.nextTimestamp <= timestamp {
+		c.nextTimestamp = 0
+	}
+	parent := c.eth1BlocksByNumber[c.eth1BlockNum]
+	c.eth1BlockNum++
+	first := c.numDepositsReadyToSend
+	head := c.blockHeader(c.eth1BlockNum, parent.Hash(), timestamp, c.seed, first, first+c.depositsToSend)
+	c.eth1BlocksByNumber[c.eth1BlockNum] = head
+	c.eth1BlockNumbersByHash[head.Hash()] = c.eth1BlockNum
+	for i := c.numDepositsReadyToSend; i < (c.numDepositsReadyToSend + c.depositsToSend); i++ {
+		c.eth1Logs[i].BlockHash = head.Hash()
+		c.eth1Logs[i].BlockNumber = c.eth1BlockNum
+	}
+	for _, leaf := range c.depositLeaves[first : first+c.depositsToSend] {
+		c.depositTree.Insert(leaf)
+	}
+	c.numDepositsReadyToSend += c.depositsToSend
+	c.depositsToSend = 0
+	c.indexLogs(first)
+	includedLogs := make([]types.Log, c.numDepositsReadyToSend-first)
+	copy(includedLogs, c.eth1Logs[first:])
+	c.markChanged()
+	return head, includedLogs
+}
+
+// notifyBlock sends a new head and the deposit logs it includes to subscribers.
+// The caller must not hold the lock.
+func (c *chainStore) notifyBlock(head *types.Header, includedLogs []types.Log) {
+	c.eth1HeadFeed.Send(head)
+	if len(includedLogs) > 0 {
+		c.eth1LogsFeed.Send(includedLogs)
+	}
+}
+
+// subscribeNewHeads registers a channel to receive every new head of the chain.
+func (c *chainStore) subscribeNewHeads(ch chan<- *types.Header) event.Subscription {
+	return c.eth1HeadFeed.Subscribe(ch)
+}
+
+// subscribeLogs registers a channel to receive the deposit logs included in or
+// removed from the chain.
+func (c *chainStore) subscribeLogs(ch chan<- []types.Log) event.Subscription {
+	return c.eth1LogsFeed.Subscribe(ch)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+	"golang.org/x/net/websocket"
+)
+
+func testDeposits(num int) []*eth1.DepositData {
+	deposits := make([]*eth1.DepositData, num)
+	for i := range deposits {
+		deposits[i] = &eth1.DepositData{
+			Pubkey:                bytes.Repeat([]byte{byte(i)}, 48),
+			WithdrawalCredentials: bytes.Repeat([]byte{byte(i)}, 32),
+			Amount:                32000000000,
+			Signature:             bytes.Repeat([]byte{byte(i)}, 96),
+		}
+	}
+	return deposits
+}
+
+func testServer(t *testing.T, numDeposits int, numGenesisDeposits int) *Server {
+	srv, err := newServer(&Config{
+		GenesisDeposits:  numGenesisDeposits,
+		GenesisTimestamp: 1000,
+		Seed:             []byte("seed"),
+	}, testDeposits(numDeposits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestNewChainStore_TooManyGenesisDeposits(t *testing.T) {
+	if _, err := newChainStore(testDeposits(2), 3, startingBlockNumber, 1000, eth1BlockTime, nil, defaultDepositContract, systemClock{}); err == nil {
+		t.Error("Expected an error when requesting more genesis deposits than available")
+	}
+}
+
+func TestChainStore_MineBlock(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	head := srv.chain.mineBlock()
+	if head.Number.Uint64() != startingBlockNumber+1 {
+		t.Errorf("Expected head at block %d, received %d", startingBlockNumber+1, head.Number.Uint64())
+	}
+	status := srv.chain.depositStatus()
+	if status.Included != 3 || status.Pending != 0 || status.Available != 1 {
+		t.Errorf("Unexpected deposit status after mining a block: %+v", status)
+	}
+	logs, err := srv.chain.filterLogs(filterCriteria{BlockHash: new(common.Hash)})
+	if err == nil {
+		t.Errorf("Expected an error filtering logs of an unknown block, received %d logs", len(logs))
+	}
+	hash := head.Hash()
+	logs, err = srv.chain.filterLogs(filterCriteria{BlockHash: &hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("Expected 2 logs in the mined block, received %d", len(logs))
+	}
+}
+
+// TestChainStore_ConcurrentAccess serves requests over HTTP and WebSocket while blocks
+// are produced, deposits are queued and the chain is reorganized, and is meant to be
+// run with the race detector enabled.
+func TestChainStore_ConcurrentAccess(t *testing.T) {
+	srv := testServer(t, 64, 1)
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(srv.ServeWebsocket())
+	defer wsSrv.Close()
+
+	countCall, err := eth1.PackDepositContractCall("get_deposit_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`,
+		`{"jsonrpc":"2.0","id":2,"method":"eth_getBlockByNumber","params":["latest",false]}`,
+		`{"jsonrpc":"2.0","id":3,"method":"eth_getLogs","params":[{"fromBlock":"0x0"}]}`,
+		fmt.Sprintf(`{"jsonrpc":"2.0","id":4,"method":"eth_call","params":[{"to":"%s","data":"%#x"},"latest"]}`, defaultDepositContract.Hex(), countCall),
+		`{"jsonrpc":"2.0","id":5,"method":"mock_reorg","params":[1]}`,
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wsURL := "ws" + strings.TrimPrefix(wsSrv.URL, "http")
+	for i := 0; i < 2; i++ {
+		conn, err := websocket.Dial(wsURL, "", httpSrv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		subscribe := `{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`
+		if _, err := conn.Write([]byte(subscribe)); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 1<<16)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := srv.chain.queueDeposits(1); err != nil {
+				t.Error(err)
+			}
+			srv.chain.mineBlock()
+			time.Sleep(time.Millisecond)
+		}
+		close(done)
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				for _, req := range requests {
+					resp, err := http.Post(httpSrv.URL, "application/json", strings.NewReader(req))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp.Body.Close()
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if head := srv.chain.head(); head.Number.Uint64() != startingBlockNumber+50 {
+		t.Errorf("Expected head at block %d, received %d", startingBlockNumber+50, head.Number.Uint64())
+	}
+	if status := srv.chain.depositStatus(); status.Included != 51 {
+		t.Errorf("Expected 51 deposits to be included, received %d", status.Included)
+	}
+}
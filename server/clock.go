@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Clock provides the current time to the mock, and can be replaced in tests which
+// need deterministic block timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// quantity is a number received as the parameter of a request, such as a number of
+// seconds, a unix timestamp or a number of blocks, either as a JSON number or as a hex
+// encoded quantity.
+type quantity uint64
+
+// UnmarshalJSON accepts both 3600 and "0xe10".
+func (q *quantity) UnmarshalJSON(data []byte) error {
+	var hex hexutil.Uint64
+	if err := json.Unmarshal(data, &hex); err == nil {
+		*q = quantity(hex)
+		return nil
+	}
+	var num uint64
+	if err := json.Unmarshal(data, &num); err != nil {
+		return fmt.Errorf("invalid quantity %s", data)
+	}
+	*q = quantity(num)
+	return nil
+}
+
+// now returns the current time of the virtual clock of the chain, as a unix timestamp.
+// The caller must hold the lock.
+func (c *chainStore) now() uint64 {
+	return uint64(c.clock.Now().Add(c.timeOffset).Unix())
+}
+
+// nextBlockTimestamp returns the timestamp of the next block produced, which is the
+// timestamp set by setNextBlockTimestamp if any, or the current time of the virtual
+// clock, always later than the timestamp of the head. The caller must hold the lock.
+func (c *chainStore) nextBlockTimestamp() uint64 {
+	if c.nextTimestamp != 0 {
+		timestamp := c.nextTimestamp
+		c.nextTimestamp = 0
+		return timestamp
+	}
+	timestamp := c.now()
+	if parent := c.eth1BlocksByNumber[c.eth1BlockNum]; timestamp <= parent.Time {
+		timestamp = parent.Time + 1
+	}
+	return timestamp
+}
+
+// catchUpClock moves the virtual clock forward to a block timestamp which is ahead
+// of it, so time keeps flowing from the head of the chain. The caller must hold the lock.
+func (c *chainStore) catchUpClock(timestamp uint64) {
+	if now := c.now(); timestamp > now {
+		c.timeOffset += time.Duration(timestamp-now) * time.Second
+	}
+}
+
+// increaseTime moves the virtual clock forward by the given number of seconds, returning
+// the total offset of the virtual clock from the clock of the mock.
+func (c *chainStore) increaseTime(seconds uint64) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.timeOffset += time.Duration(seconds) * time.Second
+	c.markChanged()
+	return c.timeOffset
+}
+
+// setNextBlockTimestamp sets the timestamp of the next block produced, which must be
+// later than the timestamp of the head.
+func (c *chainStore) setNextBlockTimestamp(timestamp uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if head := c.eth1BlocksByNumber[c.eth1BlockNum]; timestamp <= head.Time {
+		return fmt.Errorf("timestamp %d is not after the timestamp %d of the head block", timestamp, head.Time)
+	}
+	c.nextTimestamp = timestamp
+	c.markChanged()
+	return nil
+}
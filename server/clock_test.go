@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func testChainWithClock(t *testing.T, clock Clock) *chainStore {
+	chain, err := newChainStore(testDeposits(1), 1, startingBlockNumber, 1000, eth1BlockTime, nil, defaultDepositContract, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func TestChainStore_VirtualClockStartsAtHead(t *testing.T) {
+	chain := testChainWithClock(t, &fakeClock{now: time.Unix(1e9, 0)})
+	headTime := chain.head().Time
+	if head := chain.mineBlock(); head.Time != headTime+1 {
+		t.Errorf("Expected a block one second after the head at %d, received %d", headTime+1, head.Time)
+	}
+}
+
+func TestChainStore_IncreaseTime(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	chain := testChainWithClock(t, clock)
+	headTime := chain.head().Time
+
+	clock.now = clock.now.Add(10 * time.Second)
+	if head := chain.mineBlock(); head.Time != headTime+10 {
+		t.Errorf("Expected a block at %d, received %d", headTime+10, head.Time)
+	}
+	if offset := chain.increaseTime(3600); offset != 3600*time.Second-time.Duration(1e9-int64(headTime))*time.Second {
+		t.Errorf("Unexpected offset of the virtual clock %v", offset)
+	}
+	if head := chain.mineBlock(); head.Time != headTime+3610 {
+		t.Errorf("Expected a block at %d, received %d", headTime+3610, head.Time)
+	}
+}
+
+func TestChainStore_SetNextBlockTimestamp(t *testing.T) {
+	chain := testChainWithClock(t, &fakeClock{now: time.Unix(1e9, 0)})
+	headTime := chain.head().Time
+	if err := chain.setNextBlockTimestamp(headTime); err == nil {
+		t.Error("Expected an error setting the timestamp of the next block to the head timestamp")
+	}
+	if err := chain.setNextBlockTimestamp(headTime + 1000); err != nil {
+		t.Fatal(err)
+	}
+	if head := chain.mineBlock(); head.Time != headTime+1000 {
+		t.Errorf("Expected a block at %d, received %d", headTime+1000, head.Time)
+	}
+	// The virtual clock keeps flowing from the timestamp of the new head.
+	if head := chain.mineBlock(); head.Time != headTime+1001 {
+		t.Errorf("Expected a block at %d, received %d", headTime+1001, head.Time)
+	}
+}
+
+func TestQuantity_UnmarshalJSON(t *testing.T) {
+	for _, input := range []string{`3600`, `"0xe10"`} {
+		var q quantity
+		if err := json.Unmarshal([]byte(input), &q); err != nil {
+			t.Fatal(err)
+		}
+		if q != 3600 {
+			t.Errorf("Expected %s to decode to 3600, received %d", input, q)
+		}
+	}
+	var q quantity
+	if err := json.Unmarshal([]byte(`"1h"`), &q); err == nil {
+		t.Error("Expected an error decoding an invalid quantity")
+	}
+}
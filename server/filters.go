@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errInvalidTopic = errors.New("invalid topic(s)")
+
+// filterCriteria represents the filter object received as the parameter of an
+// eth_getLogs request.
+type filterCriteria struct {
+	BlockHash *common.Hash
+	FromBlock *rpc.BlockNumber
+	ToBlock   *rpc.BlockNumber
+	Addresses []common.Address
+	Topics    [][]common.Hash
+}
+
+// UnmarshalJSON sets *args fields with given data, accepting either a single value or
+// a list of values for the address field and null wildcards within the topics.
+func (args *filterCriteria) UnmarshalJSON(data []byte) error {
+	type input struct {
+		BlockHash *common.Hash     `json:"blockHash"`
+		FromBlock *rpc.BlockNumber `json:"fromBlock"`
+		ToBlock   *rpc.BlockNumber `json:"toBlock"`
+		Addresses interface{}      `json:"address"`
+		Topics    []interface{}    `json:"topics"`
+	}
+
+	var raw input
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.BlockHash != nil {
+		if raw.FromBlock != nil || raw.ToBlock != nil {
+			return errors.New("cannot specify both blockHash and fromBlock/toBlock")
+		}
+		args.BlockHash = raw.BlockHash
+	}
+	args.FromBlock = raw.FromBlock
+	args.ToBlock = raw.ToBlock
+
+	if raw.Addresses != nil {
+		switch rawAddr := raw.Addresses.(type) {
+		case []interface{}:
+			for i, addr := range rawAddr {
+				strAddr, ok := addr.(string)
+				if !ok {
+					return fmt.Errorf("non-string address at index %d", i)
+				}
+				a, err := decodeAddress(strAddr)
+				if err != nil {
+					return fmt.Errorf("invalid address at index %d: %v", i, err)
+				}
+				args.Addresses = append(args.Addresses, a)
+			}
+		case string:
+			a, err := decodeAddress(rawAddr)
+			if err != nil {
+				return fmt.Errorf("invalid address: %v", err)
+			}
+			args.Addresses = []common.Address{a}
+		default:
+			return errors.New("invalid addresses in query")
+		}
+	}
+
+	if len(raw.Topics) > 0 {
+		args.Topics = make([][]common.Hash, len(raw.Topics))
+		for i, t := range raw.Topics {
+			switch topic := t.(type) {
+			case nil:
+				// A null topic matches anything at this position.
+			case string:
+				h, err := decodeTopic(topic)
+				if err != nil {
+					return err
+				}
+				args.Topics[i] = []common.Hash{h}
+			case []interface{}:
+				// An OR-set of topics, where a null element matches anything.
+				for _, rawTopic := range topic {
+					if rawTopic == nil {
+						args.Topics[i] = nil
+						break
+					}
+					strTopic, ok := rawTopic.(string)
+					if !ok {
+						return errInvalidTopic
+					}
+					h, err := decodeTopic(strTopic)
+					if err != nil {
+						return err
+					}
+					args.Topics[i] = append(args.Topics[i], h)
+				}
+			default:
+				return errInvalidTopic
+			}
+		}
+	}
+	return nil
+}
+
+func decodeAddress(s string) (common.Address, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.AddressLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for address", len(b), common.AddressLength)
+	}
+	return common.BytesToAddress(b), err
+}
+
+func decodeTopic(s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.HashLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for topic", len(b), common.HashLength)
+	}
+	return common.BytesToHash(b), err
+}
+
+// filterLogs returns the deposit logs included in the chain so far which match
+// the given criteria, or an error if the query would return too many results.
+func (s *Server) filterLogs(crit filterCriteria) ([]types.Log, error) {
+	logs, err := s.chain.filterLogs(crit)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) > s.maxLogsPerQuery {
+		return nil, fmt.Errorf("query returned more than %d results", s.maxLogsPerQuery)
+	}
+	return logs, nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestServer_GetLogs(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	first := srv.chain.mineBlock()
+	if err := srv.chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	srv.chain.mineBlock()
+
+	headLogs, err := srv.chain.filterLogs(filterCriteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := headLogs[0].Topics[0].Hex()
+	other := "0x0000000000000000000000000000000000000000000000000000000000000001"
+	contract := headLogs[0].Address.Hex()
+	since := fmt.Sprintf(`"fromBlock":"%#x"`, first.Number.Uint64())
+	tests := []struct {
+		name   string
+		params string
+		logs   int
+		code   int
+	}{
+		{"latest block by default", `[{}]`, 1, 0},
+		{"block range", `[{"fromBlock":"0x0","toBlock":"latest"}]`, 4, 0},
+		{"block hash", fmt.Sprintf(`[{"blockHash":"%s"}]`, first.Hash().Hex()), 2, 0},
+		{"block hash and range", fmt.Sprintf(`[{"blockHash":"%s","fromBlock":"0x0"}]`, first.Hash().Hex()), 0, -32602},
+		{"unknown block hash", fmt.Sprintf(`[{"blockHash":"%s"}]`, other), 0, -32000},
+		{"single address", fmt.Sprintf(`[{%s,"address":"%s"}]`, since, contract), 3, 0},
+		{"address list", fmt.Sprintf(`[{%s,"address":["0x0000000000000000000000000000000000000001","%s"]}]`, since, contract), 3, 0},
+		{"other address", fmt.Sprintf(`[{%s,"address":"0x0000000000000000000000000000000000000001"}]`, since), 0, 0},
+		{"invalid address", `[{"address":"0x12"}]`, 0, -32602},
+		{"topic", fmt.Sprintf(`[{%s,"topics":["%s"]}]`, since, topic), 3, 0},
+		{"other topic", fmt.Sprintf(`[{%s,"topics":["%s"]}]`, since, other), 0, 0},
+		{"null topic", fmt.Sprintf(`[{%s,"topics":[null]}]`, since), 3, 0},
+		{"topic OR-set", fmt.Sprintf(`[{%s,"topics":[["%s","%s"]]}]`, since, other, topic), 3, 0},
+		{"null in topic OR-set", fmt.Sprintf(`[{%s,"topics":[["%s",null]]}]`, since, other), 3, 0},
+		{"second topic", fmt.Sprintf(`[{%s,"topics":[null,"%s"]}]`, since, topic), 0, 0},
+		{"invalid topic", fmt.Sprintf(`[{%s,"topics":[1]}]`, since), 0, -32602},
+	}
+	for _, tt := range tests {
+		resp := handleRequest(srv, "eth_getLogs", tt.params)
+		if tt.code != 0 {
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("%s: expected error code %d, received %s", tt.name, tt.code, resp)
+			}
+			continue
+		}
+		if resp.Error != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, resp.Error)
+			continue
+		}
+		var logs []types.Log
+		if err := json.Unmarshal(resp.Result, &logs); err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != tt.logs {
+			t.Errorf("%s: expected %d logs, received %d", tt.name, tt.logs, len(logs))
+		}
+	}
+
+	srv.maxLogsPerQuery = 3
+	resp := handleRequest(srv, "eth_getLogs", `[{"fromBlock":"0x0"}]`)
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "query returned more than 3 results") {
+		t.Errorf("Expected an error returning more logs than allowed, received %s", resp)
+	}
+	if resp := handleRequest(srv, "eth_getLogs", fmt.Sprintf(`[{%s}]`, since)); resp.Error != nil {
+		t.Errorf("Expected the logs to be returned up to the limit, received %v", resp.Error)
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+// registerMethods builds the registry of every JSON-RPC method served by the mock.
+func (s *Server) registerMethods() {
+	s.methods = make(methodRegistry)
+	s.methods.register("eth_blockNumber", nil, s.getBlockNumber)
+	s.methods.register("eth_chainId", nil, s.getChainID)
+	s.methods.register("net_version", nil, s.getNetVersion)
+	s.methods.register(
+		"eth_getBlockByNumber",
+		[]reflect.Type{reflect.TypeOf("s"), reflect.TypeOf(true)},
+		s.getBlockByNumber,
+	)
+	s.methods.register(
+		"eth_getBlockByHash",
+		[]reflect.Type{reflect.TypeOf("s"), reflect.TypeOf(true)},
+		s.getBlockByHash,
+	)
+	s.methods.register(
+		"eth_getTransactionByHash",
+		[]reflect.Type{reflect.TypeOf(common.Hash{})},
+		s.getTransactionByHash,
+	)
+	s.methods.register(
+		"eth_getTransactionReceipt",
+		[]reflect.Type{reflect.TypeOf(common.Hash{})},
+		s.getTransactionReceipt,
+	)
+	s.methods.register(
+		"eth_getLogs",
+		[]reflect.Type{reflect.TypeOf(filterCriteria{})},
+		s.getLogs,
+	)
+	s.methods.register(
+		"eth_getCode",
+		[]reflect.Type{reflect.TypeOf(common.Address{}), reflect.TypeOf(&rpc.BlockNumberOrHash{})},
+		s.getCode,
+	)
+	s.methods.register(
+		"eth_call",
+		[]reflect.Type{reflect.TypeOf(callArgs{}), reflect.TypeOf(&rpc.BlockNumberOrHash{})},
+		s.call,
+	)
+	s.methods.register(
+		"eth_sendRawTransaction",
+		[]reflect.Type{reflect.TypeOf(hexutil.Bytes{})},
+		s.sendRawTransaction,
+	)
+	s.methods.register(
+		"evm_mine",
+		[]reflect.Type{reflect.TypeOf(&mineOptions{})},
+		s.mine,
+	)
+	s.methods.register(
+		"evm_increaseTime",
+		[]reflect.Type{reflect.TypeOf(quantity(0))},
+		s.increaseTime,
+	)
+	s.methods.register(
+		"evm_setNextBlockTimestamp",
+		[]reflect.Type{reflect.TypeOf(quantity(0))},
+		s.setNextBlockTimestamp,
+	)
+	s.methods.register("evm_snapshot", nil, s.snapshot)
+	s.methods.register(
+		"evm_revert",
+		[]reflect.Type{reflect.TypeOf(hexutil.Uint64(0))},
+		s.revert,
+	)
+	s.methods.register(
+		"mock_reorg",
+		[]reflect.Type{reflect.TypeOf(quantity(0)), reflect.TypeOf(&reorgOptions{})},
+		s.reorg,
+	)
+	s.methods.register(
+		"mock_getDepositProof",
+		[]reflect.Type{reflect.TypeOf(quantity(0)), reflect.TypeOf(&rpc.BlockNumberOrHash{})},
+		s.getDepositProof,
+	)
+}
+
+func (s *Server) getBlockNumber(args []reflect.Value) (interface{}, error) {
+	return hexutil.Uint64(s.chain.head().Number.Uint64()), nil
+}
+
+func (s *Server) getChainID(args []reflect.Value) (interface{}, error) {
+	return hexutil.Uint64(s.chainID), nil
+}
+
+func (s *Server) getNetVersion(args []reflect.Value) (interface{}, error) {
+	return strconv.FormatUint(s.networkID, 10), nil
+}
+
+func (s *Server) getBlockByNumber(args []reflect.Value) (interface{}, error) {
+	var num uint64
+	if args[0].String() == "latest" {
+		num = s.chain.head().Number.Uint64()
+	} else {
+		n, err := hexutil.DecodeBig(args[0].String())
+		if err != nil {
+			return nil, &invalidParamsError{err.Error()}
+		}
+		num = n.Uint64()
+	}
+	block, txs := s.chain.blockWithTransactions(num)
+	if block == nil {
+		return nil, nil
+	}
+	return s.rpcBlock(block, txs, args[1].Bool())
+}
+
+func (s *Server) getBlockByHash(args []reflect.Value) (interface{}, error) {
+	blockHashBytes, err := hexutil.Decode(args[0].String())
+	if err != nil {
+		return nil, &invalidParamsError{err.Error()}
+	}
+	var blockHash [32]byte
+	copy(blockHash[:], blockHashBytes)
+	numByHash, ok := s.chain.blockNumberByHash(blockHash)
+	if !ok {
+		return nil, nil
+	}
+	block, txs := s.chain.blockWithTransactions(numByHash)
+	if block == nil {
+		return nil, nil
+	}
+	return s.rpcBlock(block, txs, args[1].Bool())
+}
+
+func (s *Server) rpcBlock(block *types.Header, txs []*depositTransaction, fullTx bool) (interface{}, error) {
+	fields, err := rpcBlock(block, txs, fullTx)
+	if err != nil {
+		return nil, &internalServerError{err.Error()}
+	}
+	return fields, nil
+}
+
+func (s *Server) getTransactionByHash(args []reflect.Value) (interface{}, error) {
+	dtx := s.chain.transactionByHash(args[0].Interface().(common.Hash))
+	if dtx == nil {
+		return nil, nil
+	}
+	return rpcTransaction(dtx), nil
+}
+
+// getTransactionReceipt returns null for transactions which are not included yet,
+// like a real node does for pending transactions.
+func (s *Server) getTransactionReceipt(args []reflect.Value) (interface{}, error) {
+	dtx := s.chain.transactionByHash(args[0].Interface().(common.Hash))
+	if dtx == nil || !dtx.included {
+		return nil, nil
+	}
+	return rpcReceipt(dtx), nil
+}
+
+func (s *Server) getLogs(args []reflect.Value) (interface{}, error) {
+	return s.filterLogs(args[0].Interface().(filterCriteria))
+}
+
+// getCode only serves code at the address of the deposit contract, every other
+// address being an account without code.
+func (s *Server) getCode(args []reflect.Value) (interface{}, error) {
+	if args[0].Interface().(common.Address) != s.chain.depositContract {
+		return hexutil.Bytes{}, nil
+	}
+	return hexutil.Bytes(eth1.DepositContractCode), nil
+}
+
+// call answers calls to the deposit contract in the state of the requested block, while
+// calls to any other address return no data like calls to an account without code.
+func (s *Server) call(args []reflect.Value) (interface{}, error) {
+	ca := args[0].Interface().(callArgs)
+	data, err := ca.data()
+	if err != nil {
+		return nil, &invalidParamsError{err.Error()}
+	}
+	if ca.To == nil || *ca.To != s.chain.depositContract {
+		return hexutil.Bytes{}, nil
+	}
+	count, root, err := s.chain.depositRootAt(args[1].Interface().(*rpc.BlockNumberOrHash))
+	if err != nil {
+		return nil, err
+	}
+	out, err := eth1.CallDepositContract(data, count, root)
+	if err != nil {
+		if err == eth1.ErrExecutionReverted {
+			return nil, err
+		}
+		return nil, &internalServerError{err.Error()}
+	}
+	return hexutil.Bytes(out), nil
+}
+
+func (s *Server) sendRawTransaction(args []reflect.Value) (interface{}, error) {
+	return s.SendRawTransaction(args[0].Interface().(hexutil.Bytes))
+}
+
+// mine produces blocks immediately regardless of the mining mode, mirroring the
+// evm_mine method of Hardhat and Anvil.
+func (s *Server) mine(args []reflect.Value) (interface{}, error) {
+	opts := mineOptions{Blocks: 1}
+	if o := args[0].Interface().(*mineOptions); o != nil {
+		opts = *o
+		if opts.Blocks == 0 {
+			opts.Blocks = 1
+		}
+	}
+	if _, err := s.MineBlocks(opts.Blocks, opts.Timestamp); err != nil {
+		return nil, &invalidParamsError{err.Error()}
+	}
+	return "0x0", nil
+}
+
+// increaseTime returns the total offset of the virtual clock in seconds.
+func (s *Server) increaseTime(args []reflect.Value) (interface{}, error) {
+	offset := s.IncreaseTime(args[0].Uint())
+	return int64(offset / time.Second), nil
+}
+
+func (s *Server) setNextBlockTimestamp(args []reflect.Value) (interface{}, error) {
+	if err := s.SetNextBlockTimestamp(args[0].Uint()); err != nil {
+		return nil, &invalidParamsError{err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) snapshot(args []reflect.Value) (interface{}, error) {
+	return hexutil.Uint64(s.Snapshot()), nil
+}
+
+func (s *Server) revert(args []reflect.Value) (interface{}, error) {
+	return s.Revert(args[0].Uint()), nil
+}
+
+func (s *Server) reorg(args []reflect.Value) (interface{}, error) {
+	opts := reorgOptions{}
+	if o := args[1].Interface().(*reorgOptions); o != nil {
+		opts = *o
+	}
+	return s.chain.reorg(args[0].Uint(), opts)
+}
+
+// getDepositProof returns the Merkle proof of an included deposit against the deposit
+// tree as of the requested block, which defaults to the head.
+func (s *Server) getDepositProof(args []reflect.Value) (interface{}, error) {
+	return s.chain.depositProof(args[0].Uint(), args[1].Interface().(*rpc.BlockNumberOrHash))
+}
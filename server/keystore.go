@@ -1,10 +1,12 @@
-package main
+package server
 
 import (
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path"
 
 	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
 )
@@ -18,6 +20,31 @@ type unencryptedKeys struct {
 	WithdrawalKey []byte `json:"withdrawal_key"`
 }
 
+// LoadUnencryptedKeys reads the validator and withdrawal private keys from every
+// JSON file of unencrypted keys in a directory.
+func LoadUnencryptedKeys(dir string) ([][]byte, [][]byte, error) {
+	fileInfo, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	validatorKeys := make([][]byte, 0)
+	withdrawalKeys := make([][]byte, 0)
+	for _, file := range fileInfo {
+		r, err := os.Open(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		vkey, wkey, err := parseUnencryptedKeysFile(r)
+		r.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		validatorKeys = append(validatorKeys, vkey...)
+		withdrawalKeys = append(withdrawalKeys, wkey...)
+	}
+	return validatorKeys, withdrawalKeys, nil
+}
+
 func parseUnencryptedKeysFile(r io.Reader) ([][]byte, [][]byte, error) {
 	encoded, err := ioutil.ReadAll(r)
 	if err != nil {
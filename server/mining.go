@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MiningMode defines when the mock produces new blocks.
+type MiningMode string
+
+const (
+	// IntervalMining produces a block every block time.
+	IntervalMining MiningMode = "interval"
+	// ManualMining only produces blocks on request, through evm_mine or the admin API.
+	ManualMining MiningMode = "manual"
+	// OnDepositMining produces a block as soon as deposits are queued.
+	OnDepositMining MiningMode = "on-deposit"
+)
+
+func (m MiningMode) validate() error {
+	switch m {
+	case IntervalMining, ManualMining, OnDepositMining:
+		return nil
+	default:
+		return fmt.Errorf("unknown mining mode %q, expected one of %q, %q or %q", m, IntervalMining, ManualMining, OnDepositMining)
+	}
+}
+
+// mineRequest asks the block producer to mine a number of blocks immediately.
+type mineRequest struct {
+	blocks    uint64
+	timestamp uint64 // Timestamp of the first block, or 0 to follow the virtual clock.
+	resp      chan *mineResult
+}
+
+type mineResult struct {
+	heads []*types.Header
+	err   error
+}
+
+// mineOptions are the optional parameters of an evm_mine request or of a request
+// to the /mine endpoint of the admin API.
+type mineOptions struct {
+	// Blocks is the number of blocks to mine, defaults to 1.
+	Blocks uint64 `json:"blocks"`
+	// Timestamp is the timestamp of the first block mined, every following block
+	// being a block time apart. Defaults to the current time of the virtual clock.
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// MineBlock produces a block immediately, including every queued deposit, and
+// returns its header.
+func (s *Server) MineBlock() (*types.Header, error) {
+	heads, err := s.MineBlocks(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return heads[0], nil
+}
+
+// MineBlocks produces a number of blocks immediately, the first of which includes
+// every queued deposit, and returns their headers. The first block has the given
+// timestamp, or the current time of the virtual clock if it is 0, and the following
+// blocks are a block time apart.
+func (s *Server) MineBlocks(num uint64, timestamp uint64) ([]*types.Header, error) {
+	if num == 0 {
+		return nil, fmt.Errorf("number of blocks must be positive, received %d", num)
+	}
+	s.lock.Lock()
+	ctx := s.ctx
+	s.lock.Unlock()
+	if ctx == nil {
+		return nil, errNotStarted
+	}
+	req := &mineRequest{
+		blocks:    num,
+		timestamp: timestamp,
+		resp:      make(chan *mineResult, 1),
+	}
+	select {
+	case s.mineRequests <- req:
+		res := <-req.resp
+		return res.heads, res.err
+	case <-ctx.Done():
+		return nil, errStopped
+	}
+}
+
+// advanceEth1Chain produces blocks according to the mining mode, and serves requests to
+// mine blocks immediately, pause or resume production, and update the block time, until
+// the context is canceled.
+func (s *Server) advanceEth1Chain(ctx context.Context, blockTime int) {
+	var tick *time.Ticker
+	if s.mining == IntervalMining {
+		tick = time.NewTicker(time.Second * time.Duration(blockTime))
+	}
+	defer func() {
+		if tick != nil {
+			tick.Stop()
+		}
+	}()
+	paused := false
+	for {
+		// Deposits queued while paused are left signaled, so that the block including
+		// them is produced as soon as production resumes.
+		depositsQueued := s.depositsQueued
+		if paused {
+			depositsQueued = nil
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickerChan(tick):
+			if !paused {
+				s.chain.mineBlock()
+			}
+		case <-depositsQueued:
+			// The deposits may already have been included by a block mined on request.
+			if s.mining == OnDepositMining && s.chain.depositStatus().Pending > 0 {
+				s.chain.mineBlock()
+			}
+		case req := <-s.mineRequests:
+			req.resp <- s.mineBlocks(req, uint64(blockTime))
+		case paused = <-s.pauseRequests:
+			log.WithField("paused", paused).Info("Updated block production")
+		case blockTime = <-s.blockTimeRequests:
+			if tick != nil {
+				tick.Stop()
+				tick = time.NewTicker(time.Second * time.Duration(blockTime))
+			}
+			log.WithField("blockTime", blockTime).Info("Updated block time")
+		}
+	}
+}
+
+// mineBlocks mines the blocks of a request, the first of which at the requested
+// timestamp or the current time, and every following one a block time later.
+func (s *Server) mineBlocks(req *mineRequest, blockTime uint64) *mineResult {
+	heads := make([]*types.Header, 0, req.blocks)
+	for i := uint64(0); i < req.blocks; i++ {
+		var head *types.Header
+		var err error
+		switch {
+		case i > 0:
+			head, err = s.chain.mineBlockAt(heads[i-1].Time + blockTime)
+		case req.timestamp != 0:
+			head, err = s.chain.mineBlockAt(req.timestamp)
+		default:
+			head = s.chain.mineBlock()
+		}
+		if err != nil {
+			return &mineResult{err: err}
+		}
+		heads = append(heads, head)
+	}
+	return &mineResult{heads: heads}
+}
+
+// tickerChan returns the channel of a ticker, or a nil channel which never
+// receives if there is no ticker.
+func tickerChan(t *time.Ticker) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+const chainFileName = "chain.json"
+
+// persistedChain is the state of the chain written to the data directory. Deposit logs
+// are derived from the deposits and their transactions, so only the blocks which include
+// them are stored.
+type persistedChain struct {
+	Seed            hexutil.Bytes       `json:"seed"`
+	DepositContract common.Address      `json:"depositContract"`
+	Headers         []*types.Header     `json:"headers"`
+	Deposits        []*eth1.DepositData `json:"deposits"`
+	Transactions    []hexutil.Bytes     `json:"transactions"` // RLP encoded transaction of each deposit.
+	DepositBlocks   []uint64            `json:"depositBlocks"`
+	Queued          int                 `json:"queued"`
+	NumReorgs       uint64              `json:"numReorgs"`
+	TimeOffset      time.Duration       `json:"timeOffset"`
+	NextTimestamp   uint64              `json:"nextTimestamp"`
+}
+
+// HasPersistedChain checks whether a chain was persisted to the data directory, in
+// which case it is resumed without reading the keys again.
+func HasPersistedChain(dataDir string) bool {
+	if dataDir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dataDir, chainFileName))
+	return err == nil
+}
+
+// markChanged notifies the persistence loop that the state of the chain changed.
+func (c *chainStore) markChanged() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// export copies the state of the chain to be persisted.
+func (c *chainStore) export() (*persistedChain, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	p := &persistedChain{
+		Seed:            c.seed,
+		DepositContract: c.depositContract,
+		Headers:         make([]*types.Header, c.eth1BlockNum+1),
+		Deposits:        c.deposits,
+		Transactions:    make([]hexutil.Bytes, len(c.depositTxs)),
+		DepositBlocks:   make([]uint64, c.numDepositsReadyToSend),
+		Queued:          c.depositsToSend,
+		NumReorgs:       c.numReorgs,
+		TimeOffset:      c.timeOffset,
+		NextTimestamp:   c.nextTimestamp,
+	}
+	for i := range p.Headers {
+		p.Headers[i] = c.eth1BlocksByNumber[uint64(i)]
+	}
+	for i := range p.DepositBlocks {
+		p.DepositBlocks[i] = c.eth1Logs[i].BlockNumber
+	}
+	for i, tx := range c.depositTxs {
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return nil, err
+		}
+		p.Transactions[i] = enc
+	}
+	return p, nil
+}
+
+// saveChainStore writes the state of the chain to the data directory, replacing the
+// previous state atomically.
+func saveChainStore(dataDir string, c *chainStore) error {
+	p, err := c.export()
+	if err != nil {
+		return err
+	}
+	enc, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dataDir, chainFileName+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(enc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dataDir, chainFileName))
+}
+
+// loadChainStore restores the chain persisted to the data directory.
+func loadChainStore(dataDir string, clock Clock) (*chainStore, error) {
+	enc, err := ioutil.ReadFile(filepath.Join(dataDir, chainFileName))
+	if err != nil {
+		return nil, err
+	}
+	var p persistedChain
+	if err := json.Unmarshal(enc, &p); err != nil {
+		return nil, fmt.Errorf("could not decode persisted chain: %v", err)
+	}
+	if len(p.Headers) == 0 {
+		return nil, fmt.Errorf("persisted chain has no blocks")
+	}
+	if len(p.DepositBlocks)+p.Queued > len(p.Deposits) {
+		return nil, fmt.Errorf(
+			"persisted chain has %d included and %d queued deposits out of %d",
+			len(p.DepositBlocks),
+			p.Queued,
+			len(p.Deposits),
+		)
+	}
+
+	blocksByNumber := make(map[uint64]*types.Header, len(p.Headers))
+	blockNumbersByHash := make(map[common.Hash]uint64, len(p.Headers))
+	for i, header := range p.Headers {
+		if header == nil || header.Number.Uint64() != uint64(i) {
+			return nil, fmt.Errorf("persisted chain is missing block %d", i)
+		}
+		if i > 0 && header.ParentHash != p.Headers[i-1].Hash() {
+			return nil, fmt.Errorf("block %d of persisted chain does not link to its parent", i)
+		}
+		blocksByNumber[uint64(i)] = header
+		blockNumbersByHash[header.Hash()] = uint64(i)
+	}
+	headNum := uint64(len(p.Headers) - 1)
+
+	txs, err := decodeTransactions(p.Transactions, p.Deposits)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := depositLogs(p.Deposits, txs, p.DepositContract)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := eth1.DepositLeaves(p.Deposits)
+	if err != nil {
+		return nil, err
+	}
+	for i, num := range p.DepositBlocks {
+		if num > headNum {
+			return nil, fmt.Errorf("deposit %d of persisted chain is included in unknown block %d", i, num)
+		}
+		logs[i].BlockHash = blocksByNumber[num].Hash()
+		logs[i].BlockNumber = num
+	}
+
+	c := &chainStore{
+		seed:                   p.Seed,
+		depositContract:        p.DepositContract,
+		deposits:               p.Deposits,
+		depositTxs:             txs,
+		txIndicesByHash:        txIndices(txs),
+		depositLeaves:          leaves,
+		depositTree:            depositTree(leaves[:len(p.DepositBlocks)]),
+		eth1BlocksByNumber:     blocksByNumber,
+		eth1BlockNumbersByHash: blockNumbersByHash,
+		eth1Logs:               logs,
+		eth1BlockNum:           headNum,
+		numDepositsReadyToSend: len(p.DepositBlocks),
+		depositsToSend:         p.Queued,
+		numReorgs:              p.NumReorgs,
+		clock:                  clock,
+		timeOffset:             p.TimeOffset,
+		nextTimestamp:          p.NextTimestamp,
+		changed:                make(chan struct{}, 1),
+	}
+	c.indexLogs(0)
+	return c, nil
+}
+
+// decodeTransactions decodes the persisted transaction of every deposit.
+func decodeTransactions(encoded []hexutil.Bytes, deposits []*eth1.DepositData) ([]*types.Transaction, error) {
+	if len(encoded) != len(deposits) {
+		return nil, fmt.Errorf("persisted chain has %d transactions for %d deposits", len(encoded), len(deposits))
+	}
+	txs := make([]*types.Transaction, len(encoded))
+	for i, enc := range encoded {
+		txs[i] = new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, txs[i]); err != nil {
+			return nil, fmt.Errorf("could not decode transaction of deposit %d: %v", i, err)
+		}
+	}
+	return txs, nil
+}
+
+// persistChain writes the state of the chain to the data directory every time it
+// changes, and one last time once the context is canceled.
+func (s *Server) persistChain(ctx context.Context) {
+	for {
+		select {
+		case <-s.chain.changed:
+			if err := saveChainStore(s.cfg.DataDir, s.chain); err != nil {
+				log.WithError(err).Error("Could not persist chain")
+			}
+		case <-ctx.Done():
+			if err := saveChainStore(s.cfg.DataDir, s.chain); err != nil {
+				log.WithError(err).Error("Could not persist chain")
+			}
+			return
+		}
+	}
+}
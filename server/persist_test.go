@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestChainStore_SaveLoad(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "eth1-mock-rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	chain, err := newChainStore(testDeposits(8), 2, startingBlockNumber, 1000, eth1BlockTime, []byte("seed"), defaultDepositContract, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.queueDeposits(3); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	if _, err := chain.reorg(1, reorgOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	chain.increaseTime(60)
+	if HasPersistedChain(dataDir) {
+		t.Fatal("Expected no chain to be persisted yet")
+	}
+	if err := saveChainStore(dataDir, chain); err != nil {
+		t.Fatal(err)
+	}
+	if !HasPersistedChain(dataDir) {
+		t.Fatal("Expected the chain to be persisted")
+	}
+
+	loaded, err := loadChainStore(dataDir, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.head().Hash() != chain.head().Hash() {
+		t.Errorf("Expected head %#x after loading, received %#x", chain.head().Hash(), loaded.head().Hash())
+	}
+	if *loaded.depositStatus() != *chain.depositStatus() {
+		t.Errorf("Expected deposit status %+v after loading, received %+v", chain.depositStatus(), loaded.depositStatus())
+	}
+	if loaded.depositTree.Root() != chain.depositTree.Root() {
+		t.Errorf("Expected deposit root %#x after loading, received %#x", chain.depositTree.Root(), loaded.depositTree.Root())
+	}
+	fromBlock := rpc.BlockNumber(0)
+	logs, err := loaded.filterLogs(filterCriteria{FromBlock: &fromBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := chain.filterLogs(filterCriteria{FromBlock: &fromBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 5 || len(expected) != 5 {
+		t.Fatalf("Expected 5 logs after loading, received %d", len(logs))
+	}
+	if len(logs) != len(expected) {
+		t.Fatalf("Expected %d logs after loading, received %d", len(expected), len(logs))
+	}
+	for i := range logs {
+		if logs[i].BlockHash != expected[i].BlockHash {
+			t.Errorf("Expected log %d in block %#x, received %#x", i, expected[i].BlockHash, logs[i].BlockHash)
+		}
+		if logs[i].TxHash != expected[i].TxHash || logs[i].TxIndex != expected[i].TxIndex {
+			t.Errorf("Expected log %d from transaction %#x, received %#x", i, expected[i].TxHash, logs[i].TxHash)
+		}
+	}
+	// Blocks produced after resuming follow the persisted virtual clock and seed.
+	if chain.mineBlock().Hash() != loaded.mineBlock().Hash() {
+		t.Error("Expected the persisted and the loaded chain to produce the same block")
+	}
+}
+
+func TestLoadChainStore_MissingTransactions(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "eth1-mock-rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	chain, err := newChainStore(testDeposits(4), 2, startingBlockNumber, 1000, eth1BlockTime, []byte("seed"), defaultDepositContract, systemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := chain.export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Transactions = nil
+	enc, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dataDir, chainFileName), enc, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadChainStore(dataDir, systemClock{}); err == nil {
+		t.Error("Expected an error loading a chain persisted without the transactions of its deposits")
+	}
+}
+
+func TestLoadChainStore_Missing(t *testing.T) {
+	if _, err := loadChainStore("/nonexistent", systemClock{}); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, received %v", err)
+	}
+}
+
+func TestNew_ResumeWithoutKeys(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "eth1-mock-rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	if _, err := New(&Config{DataDir: dataDir}); err == nil {
+		t.Fatal("Expected an error starting a new chain without genesis deposits")
+	}
+	chain, err := newChainStore(testDeposits(4), 2, startingBlockNumber, 1000, eth1BlockTime, []byte("seed"), defaultDepositContract, systemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveChainStore(dataDir, chain); err != nil {
+		t.Fatal(err)
+	}
+	// The persisted chain is resumed with its deposits, without any key.
+	srv, err := New(&Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Head().Hash() != chain.head().Hash() {
+		t.Errorf("Expected head %#x after resuming, received %#x", chain.head().Hash(), srv.Head().Hash())
+	}
+	if status := srv.DepositStatus(); status.Total != 4 || status.Included != 2 {
+		t.Errorf("Expected the persisted deposits to be resumed, received %+v", status)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DepositProof is the Merkle proof of an included deposit against the deposit tree as
+// of a block, as needed to build the Deposit objects of eth2 blocks. The proof holds
+// the siblings of the leaf at every level of the tree, followed by the number of
+// deposits mixed into the root.
+type DepositProof struct {
+	Index        uint64        `json:"index"`
+	BlockNumber  uint64        `json:"blockNumber"`
+	DepositCount uint64        `json:"depositCount"`
+	Leaf         common.Hash   `json:"leaf"`
+	Proof        []common.Hash `json:"proof"`
+	Root         common.Hash   `json:"root"`
+}
+
+// DepositProof returns the Merkle proof of the deposit at the given index against the
+// deposit tree as of the given block.
+func (s *Server) DepositProof(index uint64, blockNum uint64) (*DepositProof, error) {
+	blockNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum))
+	return s.chain.depositProof(index, &blockNrOrHash)
+}
+
+// depositProof returns the Merkle proof of the deposit at the given index against the
+// deposit tree as of the given block, which defaults to the head. The deposit must be
+// included at or before that block.
+func (c *chainStore) depositProof(index uint64, blockNrOrHash *rpc.BlockNumberOrHash) (*DepositProof, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	num, count, err := c.depositCountAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if index >= count {
+		return nil, fmt.Errorf("deposit %d is not included at block %d, which has %d deposits", index, num, count)
+	}
+	proof, err := c.depositTree.Proof(index, count)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.depositTree.RootAt(count)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]common.Hash, len(proof))
+	for i, node := range proof {
+		hashes[i] = node
+	}
+	return &DepositProof{
+		Index:        index,
+		BlockNumber:  num,
+		DepositCount: count,
+		Leaf:         c.depositLeaves[index],
+		Proof:        hashes,
+		Root:         root,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+func verifyProof(t *testing.T, proof *DepositProof) {
+	nodes := make([][32]byte, len(proof.Proof))
+	for i, node := range proof.Proof {
+		nodes[i] = node
+	}
+	if !eth1.VerifyDepositProof(proof.Leaf, nodes, proof.Index, proof.Root) {
+		t.Errorf("Expected the proof of deposit %d at block %d to be valid", proof.Index, proof.BlockNumber)
+	}
+}
+
+func TestServer_DepositProof(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	first := srv.chain.mineBlock()
+	if err := srv.chain.queueDeposits(3); err != nil {
+		t.Fatal(err)
+	}
+	srv.chain.mineBlock()
+
+	resp := handleRequest(srv, "mock_getDepositProof", `["0x1"]`)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	latest := new(DepositProof)
+	if err := json.Unmarshal(resp.Result, latest); err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Proof) != 33 || latest.DepositCount != 6 {
+		t.Errorf("Expected a proof of 33 nodes against 6 deposits, received %d nodes against %d", len(latest.Proof), latest.DepositCount)
+	}
+	verifyProof(t, latest)
+	_, root, err := srv.chain.depositRootAt(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Root != root {
+		t.Errorf("Expected the proof to be against the deposit root %#x, received %#x", root, latest.Root)
+	}
+
+	// Proofs against an earlier block are against the deposit root of that block.
+	earlier, err := srv.DepositProof(1, first.Number.Uint64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyProof(t, earlier)
+	if earlier.DepositCount != 3 || earlier.Leaf != latest.Leaf || earlier.Root == latest.Root {
+		t.Errorf("Unexpected proof of deposit 1 at block %d: %+v", first.Number.Uint64(), earlier)
+	}
+	resp = handleRequest(srv, "mock_getDepositProof", fmt.Sprintf(`[1,"%s"]`, first.Hash().Hex()))
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	byHash := new(DepositProof)
+	if err := json.Unmarshal(resp.Result, byHash); err != nil {
+		t.Fatal(err)
+	}
+	if byHash.Root != earlier.Root {
+		t.Errorf("Expected the same proof by block hash as by block number")
+	}
+
+	if _, err := srv.DepositProof(4, first.Number.Uint64()); err == nil {
+		t.Error("Expected an error proving a deposit included after the requested block")
+	}
+	if resp := handleRequest(srv, "mock_getDepositProof", `[6]`); resp.Error == nil {
+		t.Error("Expected an error proving a deposit which is not included")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/deposit-proof?index=1&block=%d", first.Number.Uint64()), nil)
+	srv.adminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from the admin API, received %d: %s", rec.Code, rec.Body)
+	}
+	fromAdmin := new(DepositProof)
+	if err := json.Unmarshal(rec.Body.Bytes(), fromAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if fromAdmin.Root != earlier.Root || fromAdmin.BlockNumber != first.Number.Uint64() {
+		t.Errorf("Expected the admin API to serve the proof %+v, received %+v", earlier, fromAdmin)
+	}
+}
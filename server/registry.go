@@ -0,0 +1,79 @@
+package server
+
+import (
+	"reflect"
+)
+
+// handlerFunc serves a JSON-RPC method from its positional arguments, which have
+// already been decoded into the types declared when the method was registered.
+type handlerFunc func(args []reflect.Value) (interface{}, error)
+
+type methodHandler struct {
+	argTypes []reflect.Type
+	fn       handlerFunc
+}
+
+// methodRegistry maps JSON-RPC method names to their handlers, and is shared by
+// the HTTP and WebSocket transports so every method is available on both.
+type methodRegistry map[string]*methodHandler
+
+// register adds a handler for a method, with the types its positional arguments
+// should be decoded into. Pointer types denote optional arguments.
+func (r methodRegistry) register(method string, argTypes []reflect.Type, fn handlerFunc) {
+	r[method] = &methodHandler{
+		argTypes: argTypes,
+		fn:       fn,
+	}
+}
+
+// handleBatch serves the messages read from a codec with the given handler, returning
+// either a single response, a list of responses for a batch, or nil if nothing should
+// be written back.
+func handleBatch(msgs []*jsonrpcMessage, batch bool, handle func(*jsonrpcMessage) *jsonrpcMessage) interface{} {
+	if !batch {
+		if resp := handle(msgs[0]); resp != nil {
+			return resp
+		}
+		return nil
+	}
+	if len(msgs) == 0 {
+		return errorMessage(&invalidRequestError{"empty batch"})
+	}
+	// Every message of a batch is handled on its own, and notifications are
+	// left out of the array of responses.
+	responses := make([]*jsonrpcMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if resp := handle(msg); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// handleMsg serves a single JSON-RPC message, returning its response or nil if
+// the message is a notification which expects no response.
+func (r methodRegistry) handleMsg(msg *jsonrpcMessage) *jsonrpcMessage {
+	if msg.isNotification() {
+		return nil
+	}
+	if !msg.isCall() {
+		log.WithField("messageType", msg.Method).Error("Can only serve RPC call types")
+		return msg.errorResponse(&invalidRequestError{"invalid request"})
+	}
+	handler, ok := r[msg.Method]
+	if !ok {
+		return msg.errorResponse(&methodNotFoundError{msg.Method})
+	}
+	args, err := parsePositionalArguments(msg.Params, handler.argTypes)
+	if err != nil {
+		return msg.errorResponse(&invalidParamsError{err.Error()})
+	}
+	result, err := handler.fn(args)
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return msg.response(result)
+}
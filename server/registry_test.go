@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveHTTP sends a raw request body to the JSON-RPC endpoint of a server and returns
+// the raw response body.
+func serveHTTP(srv *Server, body string) []byte {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(rec, req)
+	return rec.Body.Bytes()
+}
+
+// handleRequest sends a JSON-RPC request with the given raw params to the JSON-RPC
+// endpoint of a server and returns the decoded response.
+func handleRequest(srv *Server, method string, params string) *jsonrpcMessage {
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":%s}`, method, params)
+	resp := new(jsonrpcMessage)
+	json.Unmarshal(serveHTTP(srv, body), resp)
+	return resp
+}
+
+func TestServer_ErrorResponses(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"eth_unknown","params":[]}`, -32601},
+		{"undecodable argument", `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0xzz",false]}`, -32602},
+		{"missing argument", `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":[]}`, -32602},
+		{"too many arguments", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[1]}`, -32602},
+		{"invalid JSON", `{"jsonrpc":"2.0","id":1,`, -32700},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, -32600},
+		{"empty batch", `[]`, -32600},
+	}
+	for _, tt := range tests {
+		resp := new(jsonrpcMessage)
+		if err := json.Unmarshal(serveHTTP(srv, tt.body), resp); err != nil {
+			t.Errorf("%s: could not decode the response: %v", tt.name, err)
+			continue
+		}
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%s: expected error code %d, received %s", tt.name, tt.code, resp)
+		}
+	}
+
+	// Notifications are never answered, even when they fail.
+	if body := serveHTTP(srv, `{"jsonrpc":"2.0","method":"eth_unknown","params":[]}`); len(body) != 0 {
+		t.Errorf("Expected no response to a notification, received %s", body)
+	}
+}
+
+func TestServer_BatchRequests(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	body := `[
+		{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x0",false]},
+		{"jsonrpc":"2.0","method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"eth_unknown","params":[]},
+		{"jsonrpc":"2.0","id":3,"method":"eth_getBlockByNumber","params":["0x1",false]},
+		{"jsonrpc":"2.0","id":4,"method":"eth_getBlockByNumber","params":[]},
+		{"jsonrpc":"2.0","id":5}
+	]`
+	var resps []*jsonrpcMessage
+	if err := json.Unmarshal(serveHTTP(srv, body), &resps); err != nil {
+		t.Fatal(err)
+	}
+	// Every call is answered in order, leaving out the notification, and errors only
+	// fail their own element.
+	if len(resps) != 5 {
+		t.Fatalf("Expected 5 responses, received %d", len(resps))
+	}
+	for i, id := range []string{"1", "2", "3", "4", "5"} {
+		if string(resps[i].ID) != id {
+			t.Errorf("Expected response %d to answer request %s, received %s", i, id, resps[i].ID)
+		}
+	}
+	for i, code := range []int{0, -32601, 0, -32602, -32600} {
+		if code == 0 && resps[i].Error != nil {
+			t.Errorf("Unexpected error in response %d: %v", i, resps[i].Error)
+		}
+		if code != 0 && (resps[i].Error == nil || resps[i].Error.Code != code) {
+			t.Errorf("Expected error code %d in response %d, received %s", code, i, resps[i])
+		}
+	}
+	blocks := make([]map[string]interface{}, 2)
+	for i, resp := range []*jsonrpcMessage{resps[0], resps[2]} {
+		if err := json.Unmarshal(resp.Result, &blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if blocks[0]["number"] != "0x0" || blocks[1]["number"] != "0x1" {
+		t.Errorf("Expected each element to be served with its own params, received blocks %v and %v", blocks[0]["number"], blocks[1]["number"])
+	}
+
+	if body := serveHTTP(srv, `[{"jsonrpc":"2.0","method":"eth_blockNumber","params":[]}]`); len(body) != 0 {
+		t.Errorf("Expected no response to a batch of notifications, received %s", body)
+	}
+}
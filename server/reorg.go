@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgOptions controls what happens to the deposits included in the blocks
+// replaced by a simulated chain reorganization.
+type reorgOptions struct {
+	// DropDeposits un-includes the deposits of the replaced blocks, queueing them
+	// up again to be included in the next block produced.
+	DropDeposits bool `json:"dropDeposits"`
+	// DepositDelay moves the deposits of the replaced blocks this many blocks later
+	// on the competing branch, capped at the head of the chain.
+	DepositDelay uint64 `json:"depositDelay"`
+}
+
+// reorg replaces the last depth blocks of the chain with a competing branch of the
+// same length. Subscribers are notified of the deposit logs removed from the old branch,
+// of every head of the new branch, and of the logs included again on the new branch.
+func (c *chainStore) reorg(depth uint64, opts reorgOptions) (*types.Header, error) {
+	c.emitLock.Lock()
+	defer c.emitLock.Unlock()
+	c.lock.Lock()
+	if depth == 0 || depth > c.eth1BlockNum {
+		err := fmt.Errorf("cannot reorg %d blocks of a chain at block %d", depth, c.eth1BlockNum)
+		c.lock.Unlock()
+		return nil, err
+	}
+	forkPoint := c.eth1BlockNum - depth
+
+	// Every deposit included after the fork point is removed along with the old branch.
+	firstAffected := c.numDepositsReadyToSend
+	for firstAffected > 0 && c.eth1Logs[firstAffected-1].BlockNumber > forkPoint {
+		firstAffected--
+	}
+	removedLogs := make([]types.Log, c.numDepositsReadyToSend-firstAffected)
+	copy(removedLogs, c.eth1Logs[firstAffected:c.numDepositsReadyToSend])
+	for i := range removedLogs {
+		removedLogs[i].Removed = true
+	}
+
+	// Deposits of the replaced blocks are either queued up again, or moved to a block
+	// of the competing branch, which has to be known before building its headers.
+	if opts.DropDeposits {
+		for i := firstAffected; i < c.numDepositsReadyToSend; i++ {
+			c.eth1Logs[i].BlockHash = common.Hash([32]byte{})
+			c.eth1Logs[i].BlockNumber = 0
+		}
+		c.depositsToSend += c.numDepositsReadyToSend - firstAffected
+		c.numDepositsReadyToSend = firstAffected
+		c.depositTree.Truncate(uint64(firstAffected))
+	} else {
+		for i := firstAffected; i < c.numDepositsReadyToSend; i++ {
+			num := c.eth1Logs[i].BlockNumber + opts.DepositDelay
+			if num > c.eth1BlockNum {
+				num = c.eth1BlockNum
+			}
+			c.eth1Logs[i].BlockNumber = num
+		}
+	}
+
+	// The competing branch keeps the timestamps of the blocks it replaces, but derives
+	// its hashes from a seed unique to this reorg.
+	c.numReorgs++
+	branchSeed := append(append([]byte{}, c.seed...), []byte(fmt.Sprintf("reorg-%d", c.numReorgs))...)
+	newHeads := make([]*types.Header, 0, depth)
+	parent := c.eth1BlocksByNumber[forkPoint]
+	from := firstAffected
+	for num := forkPoint + 1; num <= c.eth1BlockNum; num++ {
+		to := from
+		for to < c.numDepositsReadyToSend && c.eth1Logs[to].BlockNumber == num {
+			to++
+		}
+		oldHead := c.eth1BlocksByNumber[num]
+		delete(c.eth1BlockNumbersByHash, oldHead.Hash())
+		head := c.blockHeader(num, parent.Hash(), oldHead.Time, branchSeed, from, to)
+		c.eth1BlocksByNumber[num] = head
+		c.eth1BlockNumbersByHash[head.Hash()] = num
+		for i := from; i < to; i++ {
+			c.eth1Logs[i].BlockHash = head.Hash()
+		}
+		newHeads = append(newHeads, head)
+		parent = head
+		from = to
+	}
+	c.indexLogs(firstAffected)
+	includedLogs := make([]types.Log, c.numDepositsReadyToSend-firstAffected)
+	copy(includedLogs, c.eth1Logs[firstAffected:c.numDepositsReadyToSend])
+	c.markChanged()
+	c.lock.Unlock()
+
+	log.WithField("depth", depth).Infof("Reorganized chain to new head %#x", parent.Hash())
+	if len(removedLogs) > 0 {
+		c.eth1LogsFeed.Send(removedLogs)
+	}
+	for _, head := range newHeads {
+		c.eth1HeadFeed.Send(head)
+	}
+	if len(includedLogs) > 0 {
+		c.eth1LogsFeed.Send(includedLogs)
+	}
+	return parent, nil
+}
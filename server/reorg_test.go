@@ -0,0 +1,189 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testReorgChain returns a chain with 2 deposits included in the block after the
+// starting block, 1 in the next one, and an empty block on top.
+func testReorgChain(t *testing.T) *chainStore {
+	chain := testServer(t, 8, 1).chain
+	for _, num := range []int{2, 1} {
+		if err := chain.queueDeposits(num); err != nil {
+			t.Fatal(err)
+		}
+		chain.mineBlock()
+	}
+	chain.mineBlock()
+	return chain
+}
+
+// blockLogs returns the deposit logs included in the block at the given height.
+func blockLogs(chain *chainStore, num uint64) []types.Log {
+	_, txs := chain.blockWithTransactions(num)
+	logs := make([]types.Log, len(txs))
+	for i, dtx := range txs {
+		logs[i] = dtx.log
+	}
+	return logs
+}
+
+func TestChainStore_Reorg(t *testing.T) {
+	chain := testReorgChain(t)
+	forkPoint := chain.head().Number.Uint64() - 2
+	oldHeads := make(map[uint64]*types.Header)
+	for num := forkPoint; num <= forkPoint+2; num++ {
+		oldHeads[num], _ = chain.blockWithTransactions(num)
+	}
+
+	headChan := make(chan *types.Header, 2)
+	headSub := chain.subscribeNewHeads(headChan)
+	defer headSub.Unsubscribe()
+	logsChan := make(chan []types.Log, 2)
+	logsSub := chain.subscribeLogs(logsChan)
+	defer logsSub.Unsubscribe()
+
+	head, err := chain.reorg(2, reorgOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != chain.head().Hash() || head.Number.Uint64() != forkPoint+2 {
+		t.Errorf("Expected the new head at block %d, received block %d", forkPoint+2, head.Number.Uint64())
+	}
+
+	// Blocks after the fork point are replaced, and the new branch links to the fork point.
+	if fork, _ := chain.blockWithTransactions(forkPoint); fork.Hash() != oldHeads[forkPoint].Hash() {
+		t.Error("Expected the block at the fork point to be kept")
+	}
+	parent := oldHeads[forkPoint]
+	for num := forkPoint + 1; num <= forkPoint+2; num++ {
+		block, _ := chain.blockWithTransactions(num)
+		if block.Hash() == oldHeads[num].Hash() {
+			t.Errorf("Expected block %d to be replaced", num)
+		}
+		if block.ParentHash != parent.Hash() {
+			t.Errorf("Expected block %d to link to its parent %#x, received %#x", num, parent.Hash(), block.ParentHash)
+		}
+		if block.Time != oldHeads[num].Time {
+			t.Errorf("Expected block %d to keep its timestamp %d, received %d", num, oldHeads[num].Time, block.Time)
+		}
+		if _, ok := chain.blockNumberByHash(oldHeads[num].Hash()); ok {
+			t.Errorf("Expected the replaced block %d not to be found by hash", num)
+		}
+		parent = block
+	}
+
+	// The deposit of the first replaced block is removed, then included again in the
+	// block at the same height on the new branch.
+	removed := <-logsChan
+	if len(removed) != 1 || !removed[0].Removed || removed[0].BlockHash != oldHeads[forkPoint+1].Hash() {
+		t.Errorf("Expected the log of the replaced block to be removed, received %+v", removed)
+	}
+	for num := forkPoint + 1; num <= forkPoint+2; num++ {
+		if h := <-headChan; h.Number.Uint64() != num {
+			t.Errorf("Expected a notification of the new block %d, received block %d", num, h.Number.Uint64())
+		}
+	}
+	included := <-logsChan
+	newBlock, _ := chain.blockWithTransactions(forkPoint + 1)
+	if len(included) != 1 || included[0].Removed || included[0].BlockHash != newBlock.Hash() {
+		t.Errorf("Expected the log to be included again in block %#x, received %+v", newBlock.Hash(), included)
+	}
+	if logs := blockLogs(chain, forkPoint+1); len(logs) != 1 {
+		t.Errorf("Expected the new block %d to include 1 deposit, received %d", forkPoint+1, len(logs))
+	}
+
+	if _, err := chain.reorg(0, reorgOptions{}); err == nil {
+		t.Error("Expected an error reorganizing 0 blocks")
+	}
+	if _, err := chain.reorg(chain.head().Number.Uint64()+1, reorgOptions{}); err == nil {
+		t.Error("Expected an error reorganizing more blocks than the chain has")
+	}
+}
+
+func TestChainStore_ReorgDropDeposits(t *testing.T) {
+	chain := testReorgChain(t)
+	forkPoint := chain.head().Number.Uint64() - 2
+	if _, err := chain.reorg(2, reorgOptions{DropDeposits: true}); err != nil {
+		t.Fatal(err)
+	}
+	status := chain.depositStatus()
+	if status.Included != 3 || status.Pending != 1 {
+		t.Errorf("Expected the deposit of the replaced blocks to be queued up again, received %+v", status)
+	}
+	for num := forkPoint + 1; num <= forkPoint+2; num++ {
+		if logs := blockLogs(chain, num); len(logs) != 0 {
+			t.Errorf("Expected block %d of the new branch to include no deposit, received %d", num, len(logs))
+		}
+	}
+
+	head := chain.mineBlock()
+	if logs := blockLogs(chain, head.Number.Uint64()); len(logs) != 1 || logs[0].Index != 0 {
+		t.Errorf("Expected the dropped deposit to be included in the next block, received %+v", logs)
+	}
+}
+
+func TestChainStore_ReorgDepositDelay(t *testing.T) {
+	chain := testReorgChain(t)
+	headNum := chain.head().Number.Uint64()
+	// The deposits of each replaced block move one block later, the last ones into the head.
+	if _, err := chain.reorg(3, reorgOptions{DepositDelay: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if logs := blockLogs(chain, headNum-2); len(logs) != 0 {
+		t.Errorf("Expected the deposits of block %d to be delayed, received %d logs", headNum-2, len(logs))
+	}
+	if logs := blockLogs(chain, headNum-1); len(logs) != 2 {
+		t.Errorf("Expected block %d to include the 2 delayed deposits, received %d", headNum-1, len(logs))
+	}
+	logs := blockLogs(chain, headNum)
+	if len(logs) != 1 {
+		t.Fatalf("Expected the head to include the deposit delayed past it, received %d", len(logs))
+	}
+	head := chain.head()
+	if logs[0].BlockHash != head.Hash() || logs[0].BlockNumber != headNum || logs[0].TxIndex != 0 {
+		t.Errorf("Unexpected log of the delayed deposit in the head: %+v", logs[0])
+	}
+	if status := chain.depositStatus(); status.Included != 4 || status.Pending != 0 {
+		t.Errorf("Expected delayed deposits to stay included, received %+v", status)
+	}
+}
+
+func TestChainStore_ConcurrentReorgNotifications(t *testing.T) {
+	chain := testServer(t, 8, 1).chain
+	headChan := make(chan *types.Header, 128)
+	sub := chain.subscribeNewHeads(headChan)
+	defer sub.Unsubscribe()
+
+	// Blocks are produced while the chain is reorganized, as when the block producer
+	// runs alongside a mock_reorg request.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			chain.mineBlock()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := chain.reorg(1, reorgOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	// Every head extending the previous one links to it, so no head of a replaced
+	// branch is sent after the heads which replaced it.
+	var prev *types.Header
+	for i := 0; i < 70; i++ {
+		head := <-headChan
+		if prev != nil && head.Number.Uint64() == prev.Number.Uint64()+1 && head.ParentHash != prev.Hash() {
+			t.Fatalf("Received block %d which does not link to the previous head %#x", head.Number.Uint64(), prev.Hash())
+		}
+		prev = head
+	}
+	if prev.Hash() != chain.head().Hash() {
+		t.Errorf("Expected the last notified head to be the head %#x, received %#x", chain.head().Hash(), prev.Hash())
+	}
+}
@@ -0,0 +1,581 @@
+// Package server implements a mock eth1 JSON-RPC server serving the deposit contract
+// data needed by eth2 clients, which can be run as a standalone binary or embedded
+// in Go tests.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	maxRequestContentLength = 1024 * 512
+	defaultErrorCode        = -32000
+	eth1BlockTime           = time.Second * 10
+	startingBlockNumber     = 2000
+	defaultBlockTime        = 14
+	defaultChainID          = 5
+	defaultMaxLogsPerQuery  = 10000
+	ephemeralAddr           = "127.0.0.1:0"
+	defaultShutdownTimeout  = 5 * time.Second
+)
+
+var (
+	log = logrus.WithField("prefix", "server")
+
+	defaultDepositContract = common.HexToAddress("0x4242424242424242424242424242424242424242")
+
+	errNotStarted     = errors.New("server is not started")
+	errStopped        = errors.New("server is stopped")
+	errAlreadyStarted = errors.New("server is already started")
+)
+
+// Config defines the chain served by the mock and the addresses it listens on.
+type Config struct {
+	// ValidatorKeys and WithdrawalKeys are the unencrypted private keys from which
+	// the deposits of the mock are created, in matching order. They are not needed
+	// to resume a chain persisted to DataDir.
+	ValidatorKeys  [][]byte
+	WithdrawalKeys [][]byte
+	// GenesisDeposits is the number of deposits included in the head block at startup
+	// of a new chain.
+	GenesisDeposits int
+	// BlockTime is the time between blocks in seconds, defaults to 14s (Goerli testnet).
+	BlockTime int
+	// Mining is the mode in which blocks are produced, defaults to IntervalMining.
+	Mining MiningMode
+	// HTTPAddr, WSAddr and AdminAddr are the host:port addresses of the HTTP, WebSocket
+	// and admin listeners. Empty addresses listen on an ephemeral port of the loopback
+	// interface, to be looked up with HTTPURL, WSURL and AdminURL once started.
+	HTTPAddr  string
+	WSAddr    string
+	AdminAddr string
+	// ChainID is returned by eth_chainId, defaults to 5 (Goerli testnet).
+	ChainID uint64
+	// NetworkID is returned by net_version, defaults to the ChainID.
+	NetworkID uint64
+	// GenesisTimestamp is the unix timestamp of eth1 block 0, defaults to a history
+	// ending at the current time.
+	GenesisTimestamp uint64
+	// Seed is the seed from which the hashes of the mock eth1 chain are derived.
+	Seed []byte
+	// DepositContract is the address of the deposit contract, which emits the deposit
+	// logs and answers eth_call requests. Defaults to 0x4242...4242.
+	DepositContract common.Address
+	// Clock provides the current time from which the virtual clock of the chain
+	// flows, defaults to the system clock.
+	Clock Clock
+	// DataDir is the directory to which the chain is persisted, and from which it is
+	// resumed on restart. The chain is only kept in memory if empty.
+	DataDir string
+	// MaxLogsPerQuery is the maximum number of logs returned by a single eth_getLogs
+	// request, defaults to 10000.
+	MaxLogsPerQuery int
+}
+
+// Server is a mock eth1 node serving JSON-RPC requests over HTTP and WebSocket,
+// along with an HTTP admin API to drive its chain.
+type Server struct {
+	cfg               Config
+	chain             *chainStore
+	chainID           uint64
+	networkID         uint64
+	maxLogsPerQuery   int
+	mining            MiningMode
+	mineRequests      chan *mineRequest
+	depositsQueued    chan struct{}
+	pauseRequests     chan bool
+	blockTimeRequests chan int
+	methods           methodRegistry
+
+	lock          sync.Mutex
+	ctx           context.Context
+	cancel        context.CancelFunc
+	httpListener  net.Listener
+	wsListener    net.Listener
+	adminListener net.Listener
+	httpServers   []*http.Server
+	wsCodecs      map[ServerCodec]struct{} // Open WebSocket connections, closed on shutdown.
+	stopping      bool
+	wg            sync.WaitGroup
+}
+
+type websocketHandler struct {
+	blockNum      uint64
+	methods       methodRegistry
+	subscriptions map[rpc.ID]*subscription // Active subscriptions of the connection.
+	readOperation chan readOp              // Channel for read messages from the codec.
+	readErr       chan error
+}
+
+type readOp struct {
+	msgs  []*jsonrpcMessage
+	batch bool
+}
+
+// New creates the deposits of the given keys and computes the history of the mock
+// eth1 chain, unless a chain was persisted to the data directory in which case it
+// is resumed. The server does not listen for requests until it is started.
+func New(cfg *Config) (*Server, error) {
+	// Deposits are persisted along with the chain, so we only create them from
+	// the keys when starting a new chain.
+	var deposits []*eth1.DepositData
+	if !HasPersistedChain(cfg.DataDir) {
+		if cfg.GenesisDeposits <= 0 {
+			return nil, fmt.Errorf("number of genesis deposits must be positive, received %d", cfg.GenesisDeposits)
+		}
+		var err error
+		deposits, err = createDepositDataFromKeys(cfg.ValidatorKeys, cfg.WithdrawalKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newServer(cfg, deposits)
+}
+
+// newServer creates a server for a list of deposits which were already created,
+// or for the chain persisted to the data directory if there is one.
+func newServer(cfg *Config, deposits []*eth1.DepositData) (*Server, error) {
+	c := *cfg
+	if c.BlockTime <= 0 {
+		c.BlockTime = defaultBlockTime
+	}
+	if c.ChainID == 0 {
+		c.ChainID = defaultChainID
+	}
+	if c.NetworkID == 0 {
+		c.NetworkID = c.ChainID
+	}
+	if c.MaxLogsPerQuery <= 0 {
+		c.MaxLogsPerQuery = defaultMaxLogsPerQuery
+	}
+	if c.Clock == nil {
+		c.Clock = systemClock{}
+	}
+	if c.DepositContract == (common.Address{}) {
+		c.DepositContract = defaultDepositContract
+	}
+	if c.Mining == "" {
+		c.Mining = IntervalMining
+	}
+	if err := c.Mining.validate(); err != nil {
+		return nil, err
+	}
+
+	chain, err := openChainStore(&c, deposits)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:               c,
+		chain:             chain,
+		chainID:           c.ChainID,
+		networkID:         c.NetworkID,
+		maxLogsPerQuery:   c.MaxLogsPerQuery,
+		mining:            c.Mining,
+		mineRequests:      make(chan *mineRequest),
+		depositsQueued:    make(chan struct{}, 1),
+		pauseRequests:     make(chan bool),
+		blockTimeRequests: make(chan int),
+		wsCodecs:          make(map[ServerCodec]struct{}),
+	}
+	s.registerMethods()
+	return s, nil
+}
+
+// openChainStore resumes the chain persisted to the data directory if there is one,
+// or otherwise creates a new chain for the given deposits.
+func openChainStore(c *Config, deposits []*eth1.DepositData) (*chainStore, error) {
+	if HasPersistedChain(c.DataDir) {
+		chain, err := loadChainStore(c.DataDir, c.Clock)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("head", chain.head().Number.Uint64()).Infof("Resumed chain persisted to %s", c.DataDir)
+		if chain.depositContract != c.DepositContract {
+			log.Warnf("Persisted chain uses deposit contract %#x instead of %#x", chain.depositContract, c.DepositContract)
+		}
+		return chain, nil
+	}
+	// We also compute a history of eth1 blocks to be used to respond to RPC requests for
+	// blocks by number, getting our mock server to closely resemble a real chain.
+	genesisTime := c.GenesisTimestamp
+	if genesisTime == 0 {
+		genesisTime = uint64(c.Clock.Now().Add(-startingBlockNumber * eth1BlockTime).Unix())
+	}
+	return newChainStore(
+		deposits,
+		c.GenesisDeposits,
+		startingBlockNumber,
+		genesisTime,
+		eth1BlockTime,
+		c.Seed,
+		c.DepositContract,
+		c.Clock,
+	)
+}
+
+// Start listens on the configured addresses and starts serving requests and producing
+// blocks in the background. Block production stops when the context is canceled.
+func (s *Server) Start(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ctx != nil {
+		return errAlreadyStarted
+	}
+
+	httpListener, err := listen(s.cfg.HTTPAddr)
+	if err != nil {
+		return err
+	}
+	wsListener, err := listen(s.cfg.WSAddr)
+	if err != nil {
+		httpListener.Close()
+		return err
+	}
+	adminListener, err := listen(s.cfg.AdminAddr)
+	if err != nil {
+		httpListener.Close()
+		wsListener.Close()
+		return err
+	}
+	s.httpListener = httpListener
+	s.wsListener = wsListener
+	s.adminListener = adminListener
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	log.Printf("Starting HTTP listener on %s", httpListener.Addr())
+	s.serve(httpListener, s)
+	log.Printf("Starting WebSocket listener on %s", wsListener.Addr())
+	s.serve(wsListener, s.ServeWebsocket())
+	log.Printf("Starting admin HTTP listener on %s", adminListener.Addr())
+	s.serve(adminListener, s.adminHandler())
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.advanceEth1Chain(s.ctx, s.cfg.BlockTime)
+	}()
+	if s.cfg.DataDir != "" {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.persistChain(s.ctx)
+		}()
+	}
+	return nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		addr = ephemeralAddr
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serve serves requests from a listener with the given handler in the background.
+// The caller must hold the lock.
+func (s *Server) serve(l net.Listener, handler http.Handler) {
+	srv := &http.Server{Handler: handler}
+	s.httpServers = append(s.httpServers, srv)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Could not serve requests")
+		}
+	}()
+}
+
+// Shutdown stops the server gracefully: it closes the listeners, waits for in-flight
+// requests to complete until the context expires, closes every WebSocket connection
+// and finally stops producing blocks, persisting the chain one last time.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	if s.cancel == nil || s.stopping {
+		s.lock.Unlock()
+		return nil
+	}
+	s.stopping = true
+	servers := s.httpServers
+	s.httpServers = nil
+	codecs := make([]ServerCodec, 0, len(s.wsCodecs))
+	for codec := range s.wsCodecs {
+		codecs = append(codecs, codec)
+	}
+	s.lock.Unlock()
+
+	var shutdownErr error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			// In-flight requests did not complete in time, so we drop their connections.
+			srv.Close()
+			if shutdownErr == nil {
+				shutdownErr = err
+			}
+		}
+	}
+	// Hijacked WebSocket connections are not tracked by the HTTP server, so we close
+	// them ourselves, sending a close frame to their subscribers.
+	for _, codec := range codecs {
+		codec.Close()
+	}
+	s.cancel()
+	s.wg.Wait()
+	log.Info("Stopped server")
+	return shutdownErr
+}
+
+// Stop shuts the server down, waiting a few seconds at most for in-flight requests.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Could not shut down gracefully")
+	}
+}
+
+// trackCodec registers an open WebSocket connection to be closed on shutdown,
+// returning false if the server is already shutting down.
+func (s *Server) trackCodec(codec ServerCodec) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.wsCodecs[codec] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackCodec(codec ServerCodec) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.wsCodecs, codec)
+}
+
+// HTTPURL returns the URL of the HTTP JSON-RPC endpoint of a started server.
+func (s *Server) HTTPURL() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.httpListener == nil {
+		return ""
+	}
+	return "http://" + s.httpListener.Addr().String()
+}
+
+// WSURL returns the URL of the WebSocket JSON-RPC endpoint of a started server.
+func (s *Server) WSURL() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.wsListener == nil {
+		return ""
+	}
+	return "ws://" + s.wsListener.Addr().String()
+}
+
+// AdminURL returns the URL of the admin API of a started server.
+func (s *Server) AdminURL() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.adminListener == nil {
+		return ""
+	}
+	return "http://" + s.adminListener.Addr().String()
+}
+
+// QueueDeposits queues up a number of deposits from the keystore to be included
+// in the next block produced.
+func (s *Server) QueueDeposits(num int) error {
+	if err := s.chain.queueDeposits(num); err != nil {
+		return err
+	}
+	s.notifyDepositsQueued()
+	return nil
+}
+
+// notifyDepositsQueued notifies the block producer that deposits were queued up. It is
+// only notified once of deposits queued before it gets to produce a block.
+func (s *Server) notifyDepositsQueued() {
+	select {
+	case s.depositsQueued <- struct{}{}:
+	default:
+	}
+}
+
+// DepositStatus reports how many deposits from the keystore were included, are
+// queued up for the next block, and are still available.
+func (s *Server) DepositStatus() *DepositStatus {
+	return s.chain.depositStatus()
+}
+
+// IncreaseTime moves the virtual clock of the chain forward by the given number of
+// seconds, returning its total offset from the clock of the server.
+func (s *Server) IncreaseTime(seconds uint64) time.Duration {
+	return s.chain.increaseTime(seconds)
+}
+
+// SetNextBlockTimestamp sets the timestamp of the next block produced, which must
+// be later than the timestamp of the head.
+func (s *Server) SetNextBlockTimestamp(timestamp uint64) error {
+	return s.chain.setNextBlockTimestamp(timestamp)
+}
+
+// Snapshot captures the state of the chain, returning the ID with which it can be
+// restored by Revert.
+func (s *Server) Snapshot() uint64 {
+	return s.chain.snapshot()
+}
+
+// Revert restores the state of the chain captured by a snapshot, discarding that
+// snapshot and every later one. It returns false if the snapshot does not exist.
+func (s *Server) Revert(id uint64) bool {
+	return s.chain.revert(id)
+}
+
+// Head returns the latest block of the chain.
+func (s *Server) Head() *types.Header {
+	return s.chain.head()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	body := io.LimitReader(r.Body, maxRequestContentLength)
+	conn := &httpServerConn{Reader: body, Writer: w, r: r}
+	codec := NewJSONCodec(conn)
+	defer codec.Close()
+	msgs, batch, err := codec.Read()
+	if err != nil {
+		log.WithError(err).Error("Could not read data from request")
+		writeResponse(ctx, codec, errorMessage(&parseError{err.Error()}))
+		return
+	}
+	if resp := handleBatch(msgs, batch, s.methods.handleMsg); resp != nil {
+		writeResponse(ctx, codec, resp)
+	}
+}
+
+// writeResponse sends a response or a batch of responses back over the codec,
+// logging any JSON-RPC errors they contain.
+func writeResponse(ctx context.Context, codec ServerCodec, resp interface{}) {
+	switch r := resp.(type) {
+	case *jsonrpcMessage:
+		logResponseError(r)
+	case []*jsonrpcMessage:
+		for _, msg := range r {
+			logResponseError(msg)
+		}
+	}
+	if err := codec.Write(ctx, resp); err != nil {
+		log.WithError(err).Error("Could not write response")
+	}
+}
+
+func logResponseError(msg *jsonrpcMessage) {
+	if msg.Error != nil {
+		log.WithField("code", msg.Error.Code).Error(msg.Error.Message)
+	}
+}
+
+func (s *Server) ServeWebsocket() http.Handler {
+	return websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			codec := newWebsocketCodec(conn)
+			wsHandler := &websocketHandler{
+				blockNum:      0,
+				methods:       s.methods,
+				subscriptions: make(map[rpc.ID]*subscription),
+				readOperation: make(chan readOp),
+				readErr:       make(chan error),
+			}
+
+			defer codec.Close()
+			if !s.trackCodec(codec) {
+				return
+			}
+			defer s.untrackCodec(codec)
+			// Listen to read events from the codec and dispatch events or errors accordingly.
+			go wsHandler.websocketReadLoop(codec)
+			go wsHandler.dispatchWebsocketEventLoop(codec, s.chain)
+			<-codec.Closed()
+		},
+	}
+}
+
+func (w *websocketHandler) dispatchWebsocketEventLoop(codec ServerCodec, chain *chainStore) {
+	// Chain events are queued up by a separate goroutine, as requests served by this
+	// loop, such as mock_reorg or evm_mine, wait for the chain to send its events. The
+	// channels are unbuffered so that events of both feeds are queued up in the order
+	// the chain sends them. They are drained until the feeds are unsubscribed, even once
+	// the connection is closed, as this loop may be waiting for the chain to send its
+	// events to them.
+	done := make(chan struct{})
+	defer close(done)
+	headChan := make(chan *types.Header)
+	headSub := chain.subscribeNewHeads(headChan)
+	defer headSub.Unsubscribe()
+	logsChan := make(chan []types.Log)
+	logsSub := chain.subscribeLogs(logsChan)
+	defer logsSub.Unsubscribe()
+	notifications := make(chan *notification)
+	go queueNotifications(done, headChan, logsChan, notifications)
+	for {
+		select {
+		case <-codec.Closed():
+			return
+		case err := <-w.readErr:
+			if err != io.EOF {
+				log.WithError(err).Error("Could not read data from request")
+			}
+			codec.Close()
+			return
+		case n := <-notifications:
+			if n.head != nil {
+				w.notifyHead(codec, n.head)
+			} else {
+				w.notifyLogs(codec, n.logs)
+			}
+		case op := <-w.readOperation:
+			if resp := handleBatch(op.msgs, op.batch, w.handleMsg); resp != nil {
+				writeResponse(context.Background(), codec, resp)
+			}
+		}
+	}
+}
+
+func (w *websocketHandler) websocketReadLoop(codec ServerCodec) {
+	for {
+		msgs, batch, err := codec.Read()
+		if _, ok := err.(*json.SyntaxError); ok {
+			if err := codec.Write(context.Background(), errorMessage(&parseError{err.Error()})); err != nil {
+				log.Error(err)
+			}
+		}
+		if err != nil {
+			select {
+			case w.readErr <- err:
+			case <-codec.Closed():
+			}
+			return
+		}
+		select {
+		case w.readOperation <- readOp{msgs: msgs, batch: batch}:
+		case <-codec.Closed():
+			return
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+	"golang.org/x/net/websocket"
+)
+
+func TestServer_StartStop(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	if _, err := srv.MineBlock(); err != errNotStarted {
+		t.Errorf("Expected %v mining a block before starting, received %v", errNotStarted, err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background()); err != errAlreadyStarted {
+		t.Errorf("Expected %v starting the server twice, received %v", errAlreadyStarted, err)
+	}
+
+	if err := srv.QueueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	head, err := srv.MineBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Number.Uint64() != startingBlockNumber+1 {
+		t.Errorf("Expected head at block %d, received %d", startingBlockNumber+1, head.Number.Uint64())
+	}
+	if status := srv.DepositStatus(); status.Included != 3 {
+		t.Errorf("Expected 3 deposits to be included, received %d", status.Included)
+	}
+
+	req := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	resp, err := http.Post(srv.HTTPURL(), "application/json", strings.NewReader(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"result":"0x7d1"`) {
+		t.Errorf("Expected block number 0x7d1 over HTTP, received %s", body)
+	}
+	conn, err := websocket.Dial(srv.WSURL(), "", srv.HTTPURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	srv.Stop()
+	if _, err := http.Post(srv.HTTPURL(), "application/json", strings.NewReader(req)); err == nil {
+		t.Error("Expected an error sending a request to a stopped server")
+	}
+	if _, err := srv.MineBlock(); err != errStopped {
+		t.Errorf("Expected %v mining a block after stopping, received %v", errStopped, err)
+	}
+}
+
+func TestServer_ShutdownClosesWebsockets(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := websocket.Dial(srv.WSURL(), "", srv.HTTPURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	subscribe := `{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`
+	if _, err := conn.Write([]byte(subscribe)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1<<16)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("Expected the subscriber to see a clean close, received %v", err)
+	}
+}
+
+func TestServer_ManualMining(t *testing.T) {
+	srv, err := newServer(&Config{
+		GenesisDeposits: 1,
+		BlockTime:       1,
+		Mining:          ManualMining,
+	}, testDeposits(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	time.Sleep(1500 * time.Millisecond)
+	if num := srv.Head().Number.Uint64(); num != startingBlockNumber {
+		t.Errorf("Expected no block to be produced in manual mode, head is at block %d", num)
+	}
+	timestamp := srv.Head().Time + 100
+	heads, err := srv.MineBlocks(3, timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heads) != 3 {
+		t.Fatalf("Expected 3 blocks to be mined, received %d", len(heads))
+	}
+	if heads[0].Time != timestamp || heads[2].Time != timestamp+2 {
+		t.Errorf("Unexpected timestamps %d and %d of the mined blocks", heads[0].Time, heads[2].Time)
+	}
+	if _, err := srv.MineBlocks(1, timestamp); err == nil {
+		t.Error("Expected an error mining a block with a timestamp before the head")
+	}
+}
+
+func TestServer_MineOverWebsocket(t *testing.T) {
+	srv, err := newServer(&Config{
+		GenesisDeposits: 1,
+		Mining:          ManualMining,
+	}, testDeposits(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	client := dialWebsocket(t, srv.WSURL(), srv.HTTPURL())
+	defer client.conn.Close()
+	headsID := client.subscribe(`["newHeads"]`)
+
+	// The block producer sends the head of every block mined to the connection which
+	// waits for it to be done.
+	resp := client.call("evm_mine", `[{"blocks":2}]`)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		n := client.notification()
+		if n.ID != headsID || notifiedHead(t, n).Number.Uint64() != startingBlockNumber+i {
+			t.Errorf("Expected a notification of block %d, received %s", startingBlockNumber+i, n.Result)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_OnDepositMining(t *testing.T) {
+	srv, err := newServer(&Config{
+		GenesisDeposits: 1,
+		Mining:          OnDepositMining,
+	}, testDeposits(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headChan := make(chan *types.Header, 1)
+	sub := srv.chain.subscribeNewHeads(headChan)
+	defer sub.Unsubscribe()
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	if err := srv.QueueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case head := <-headChan:
+		if head.Number.Uint64() != startingBlockNumber+1 {
+			t.Errorf("Expected block %d to be produced, received %d", startingBlockNumber+1, head.Number.Uint64())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a block to be produced as soon as deposits were queued")
+	}
+	if status := srv.DepositStatus(); status.Included != 3 {
+		t.Errorf("Expected 3 deposits to be included, received %d", status.Included)
+	}
+}
+
+func TestNewServer_UnknownMiningMode(t *testing.T) {
+	if _, err := newServer(&Config{GenesisDeposits: 1, Mining: "instant"}, testDeposits(1)); err == nil {
+		t.Error("Expected an error creating a server with an unknown mining mode")
+	}
+}
+
+func TestServer_DepositContract(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	call := func(method string, params string) string {
+		resp := handleRequest(srv, method, params)
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error calling %s: %v", method, resp.Error)
+		}
+		return string(resp.Result)
+	}
+
+	contract := defaultDepositContract.Hex()
+	if code := call("eth_getCode", `["`+contract+`","latest"]`); code == `"0x"` {
+		t.Error("Expected the deposit contract to have code")
+	}
+	if code := call("eth_getCode", `["0x0000000000000000000000000000000000000001","latest"]`); code != `"0x"` {
+		t.Errorf("Expected another address to have no code, received %s", code)
+	}
+	data, err := eth1.PackDepositContractCall("get_deposit_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	countCall := `[{"to":"%s","data":"%#x"},"latest"]`
+	if res := call("eth_call", fmt.Sprintf(countCall, contract, data)); res == `"0x"` {
+		t.Error("Expected the deposit contract to answer a call for the deposit count")
+	}
+	if res := call("eth_call", fmt.Sprintf(countCall, "0x0000000000000000000000000000000000000001", data)); res != `"0x"` {
+		t.Errorf("Expected a call to another address to return no data, received %s", res)
+	}
+}
+
+func TestServer_BlockHistory(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	getBlock := func(method string, params string) map[string]interface{} {
+		resp := handleRequest(srv, method, params)
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error calling %s: %v", method, resp.Error)
+		}
+		var block map[string]interface{}
+		if err := json.Unmarshal(resp.Result, &block); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+
+	// Walking the parent links from the head goes through every block down to block 0.
+	hash := srv.chain.head().Hash().Hex()
+	for num := startingBlockNumber; ; num-- {
+		block := getBlock("eth_getBlockByHash", fmt.Sprintf(`["%s",false]`, hash))
+		if block == nil {
+			t.Fatalf("Expected block %d to be found by hash %s", num, hash)
+		}
+		if block["number"] != hexutil.EncodeUint64(uint64(num)) || block["hash"] != hash {
+			t.Fatalf("Expected block %d with hash %s, received block %v with hash %v", num, hash, block["number"], block["hash"])
+		}
+		if num == 0 {
+			break
+		}
+		hash = block["parentHash"].(string)
+	}
+
+	if block := getBlock("eth_getBlockByNumber", `["0x5",false]`); block == nil || block["number"] != "0x5" {
+		t.Errorf("Expected block 5, received %v", block)
+	}
+	unknown := fmt.Sprintf(`["%#x",false]`, startingBlockNumber+1)
+	if block := getBlock("eth_getBlockByNumber", unknown); block != nil {
+		t.Errorf("Expected no block after the head, received %v", block)
+	}
+	if block := getBlock("eth_getBlockByHash", `["0x0000000000000000000000000000000000000000000000000000000000000001",false]`); block != nil {
+		t.Errorf("Expected no block for an unknown hash, received %v", block)
+	}
+}
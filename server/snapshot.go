@@ -0,0 +1,131 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+// chainSnapshot is a copy of the state of the chain which can be restored later on.
+// Headers and lists of deposits, transactions and leaves are never modified once
+// created, so they are shared with the live chain.
+type chainSnapshot struct {
+	deposits               []*eth1.DepositData
+	depositTxs             []*types.Transaction
+	txIndicesByHash        map[common.Hash]int
+	depositLeaves          [][32]byte
+	depositTree            *eth1.DepositTree
+	blocksByNumber         map[uint64]*types.Header
+	blockNumbersByHash     map[common.Hash]uint64
+	logs                   []types.Log
+	blockNum               uint64
+	numDepositsReadyToSend int
+	depositsToSend         int
+	numReorgs              uint64
+	timeOffset             time.Duration
+	nextTimestamp          uint64
+}
+
+// snapshot captures the current state of the chain, returning the ID with which it
+// can be restored. IDs start at 1 and increase with every snapshot, so the ID of a
+// discarded snapshot is never reused.
+func (c *chainStore) snapshot() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	snap := &chainSnapshot{
+		deposits:               c.deposits,
+		depositTxs:             c.depositTxs,
+		txIndicesByHash:        c.txIndicesByHash,
+		depositLeaves:          c.depositLeaves,
+		depositTree:            c.depositTree.Copy(),
+		blocksByNumber:         make(map[uint64]*types.Header, len(c.eth1BlocksByNumber)),
+		blockNumbersByHash:     make(map[common.Hash]uint64, len(c.eth1BlockNumbersByHash)),
+		logs:                   make([]types.Log, len(c.eth1Logs)),
+		blockNum:               c.eth1BlockNum,
+		numDepositsReadyToSend: c.numDepositsReadyToSend,
+		depositsToSend:         c.depositsToSend,
+		numReorgs:              c.numReorgs,
+		timeOffset:             c.timeOffset,
+		nextTimestamp:          c.nextTimestamp,
+	}
+	for k, v := range c.eth1BlocksByNumber {
+		snap.blocksByNumber[k] = v
+	}
+	for k, v := range c.eth1BlockNumbersByHash {
+		snap.blockNumbersByHash[k] = v
+	}
+	copy(snap.logs, c.eth1Logs)
+	if c.snapshots == nil {
+		c.snapshots = make(map[uint64]*chainSnapshot)
+	}
+	c.lastSnapshotID++
+	c.snapshots[c.lastSnapshotID] = snap
+	return c.lastSnapshotID
+}
+
+// revert restores the state of the chain captured by the snapshot with the given ID,
+// discarding that snapshot and every later one, and returns whether the snapshot
+// existed. Subscribers are notified of the deposit logs removed from the chain, of
+// the restored head, and of the deposit logs included again.
+func (c *chainStore) revert(id uint64) bool {
+	c.emitLock.Lock()
+	defer c.emitLock.Unlock()
+	c.lock.Lock()
+	snap, ok := c.snapshots[id]
+	if !ok {
+		c.lock.Unlock()
+		return false
+	}
+	for later := range c.snapshots {
+		if later >= id {
+			delete(c.snapshots, later)
+		}
+	}
+
+	// Logs whose inclusion differs between the live chain and the snapshot are removed,
+	// and those included in the snapshot are sent again as part of the restored chain.
+	removedLogs := make([]types.Log, 0)
+	for i := 0; i < c.numDepositsReadyToSend; i++ {
+		if i >= snap.numDepositsReadyToSend || snap.logs[i].BlockHash != c.eth1Logs[i].BlockHash {
+			l := c.eth1Logs[i]
+			l.Removed = true
+			removedLogs = append(removedLogs, l)
+		}
+	}
+	includedLogs := make([]types.Log, 0)
+	for i := 0; i < snap.numDepositsReadyToSend; i++ {
+		if i >= c.numDepositsReadyToSend || snap.logs[i].BlockHash != c.eth1Logs[i].BlockHash {
+			includedLogs = append(includedLogs, snap.logs[i])
+		}
+	}
+
+	c.deposits = snap.deposits
+	c.depositTxs = snap.depositTxs
+	c.txIndicesByHash = snap.txIndicesByHash
+	c.depositLeaves = snap.depositLeaves
+	c.depositTree = snap.depositTree
+	c.eth1BlocksByNumber = snap.blocksByNumber
+	c.eth1BlockNumbersByHash = snap.blockNumbersByHash
+	c.eth1Logs = snap.logs
+	c.eth1BlockNum = snap.blockNum
+	c.numDepositsReadyToSend = snap.numDepositsReadyToSend
+	c.depositsToSend = snap.depositsToSend
+	c.numReorgs = snap.numReorgs
+	c.timeOffset = snap.timeOffset
+	c.nextTimestamp = snap.nextTimestamp
+	head := c.eth1BlocksByNumber[c.eth1BlockNum]
+	c.markChanged()
+	c.lock.Unlock()
+
+	log.WithField("snapshot", id).Infof("Reverted chain to head %#x", head.Hash())
+	if len(removedLogs) > 0 {
+		c.eth1LogsFeed.Send(removedLogs)
+	}
+	c.eth1HeadFeed.Send(head)
+	if len(includedLogs) > 0 {
+		c.eth1LogsFeed.Send(includedLogs)
+	}
+	return true
+}
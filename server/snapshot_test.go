@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChainStore_SnapshotRevert(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	chain := srv.chain
+	if err := chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	snapHead := chain.head()
+	id := chain.snapshot()
+
+	if err := chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	if _, err := chain.reorg(2, reorgOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.queueDeposits(3); err != nil {
+		t.Fatal(err)
+	}
+	chain.increaseTime(3600)
+	later := chain.snapshot()
+
+	// The snapshot is reverted over the connection which receives the notifications,
+	// which must not block the chain.
+	client, closeClient := testWebsocket(t, srv)
+	defer closeClient()
+	headsID := client.subscribe(`["newHeads"]`)
+	logsID := client.subscribe(`["logs",{}]`)
+	resp := client.call("evm_revert", fmt.Sprintf(`["%#x"]`, id))
+	if resp.Error != nil || string(resp.Result) != "true" {
+		t.Fatalf("Expected the snapshot to be reverted, received %s", resp)
+	}
+	for i := 0; i < 3; i++ {
+		n := client.notification()
+		if n.ID != logsID || !notifiedLog(t, n).Removed {
+			t.Fatalf("Expected removed log %d, received %s", i, n.Result)
+		}
+	}
+	n := client.notification()
+	if n.ID != headsID || notifiedHead(t, n).Hash() != snapHead.Hash() {
+		t.Errorf("Expected subscribers to be notified of head %#x, received %s", snapHead.Hash(), n.Result)
+	}
+	n = client.notification()
+	if n.ID != logsID || notifiedLog(t, n).Removed || notifiedLog(t, n).BlockHash != snapHead.Hash() {
+		t.Errorf("Expected the deposit of the snapshot head to be included again, received %s", n.Result)
+	}
+	client.expectNoNotification()
+
+	if head := chain.head(); head.Hash() != snapHead.Hash() {
+		t.Errorf("Expected head %#x after reverting, received %#x", snapHead.Hash(), head.Hash())
+	}
+	if num, ok := chain.blockNumberByHash(snapHead.Hash()); !ok || num != snapHead.Number.Uint64() {
+		t.Error("Expected the snapshot head to be found by hash")
+	}
+	status := chain.depositStatus()
+	if status.Included != 2 || status.Pending != 0 || status.Available != 6 {
+		t.Errorf("Unexpected deposit status after reverting: %+v", status)
+	}
+	if chain.revert(later) {
+		t.Error("Expected snapshots taken after the reverted one to be discarded")
+	}
+	if chain.revert(id) {
+		t.Error("Expected a reverted snapshot to be discarded")
+	}
+	// The IDs of discarded snapshots are never reused.
+	if next := chain.snapshot(); next <= later {
+		t.Errorf("Expected a snapshot ID greater than %d, received %d", later, next)
+	}
+	if chain.revert(later) {
+		t.Error("Expected the ID of a discarded snapshot not to be reused")
+	}
+}
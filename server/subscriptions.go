@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+const (
+	newHeadsSubscription = "newHeads"
+	logsSubscription     = "logs"
+)
+
+// subscription is an active eth_subscribe subscription of a websocket connection.
+type subscription struct {
+	name string
+	crit filterCriteria // Address and topics criteria of a logs subscription.
+}
+
+// handleMsg serves a message received over a websocket connection, managing the
+// subscriptions of the connection and delegating every other method to the registry.
+func (w *websocketHandler) handleMsg(msg *jsonrpcMessage) *jsonrpcMessage {
+	switch {
+	case msg.isCall() && msg.isSubscribe():
+		return w.subscribe(msg)
+	case msg.isCall() && msg.isUnsubscribe():
+		return w.unsubscribe(msg)
+	default:
+		return w.methods.handleMsg(msg)
+	}
+}
+
+func (w *websocketHandler) subscribe(msg *jsonrpcMessage) *jsonrpcMessage {
+	name, err := parseSubscriptionName(msg.Params)
+	if err != nil {
+		return msg.errorResponse(&invalidParamsError{err.Error()})
+	}
+	sub := &subscription{name: name}
+	switch name {
+	case newHeadsSubscription:
+	case logsSubscription:
+		typs := []reflect.Type{
+			reflect.TypeOf("s"),
+			reflect.TypeOf(&filterCriteria{}),
+		}
+		args, err := parsePositionalArguments(msg.Params, typs)
+		if err != nil {
+			return msg.errorResponse(&invalidParamsError{err.Error()})
+		}
+		if crit := args[1].Interface().(*filterCriteria); crit != nil {
+			sub.crit = *crit
+		}
+	default:
+		return msg.errorResponse(&subscriptionNotFoundError{msg.namespace(), name})
+	}
+	id := rpc.NewID()
+	w.subscriptions[id] = sub
+	log.WithField("id", id).Debugf("New %s subscription", name)
+	return msg.response(id)
+}
+
+func (w *websocketHandler) unsubscribe(msg *jsonrpcMessage) *jsonrpcMessage {
+	typs := []reflect.Type{
+		reflect.TypeOf(rpc.ID("")),
+	}
+	args, err := parsePositionalArguments(msg.Params, typs)
+	if err != nil {
+		return msg.errorResponse(&invalidParamsError{err.Error()})
+	}
+	id := args[0].Interface().(rpc.ID)
+	if _, ok := w.subscriptions[id]; !ok {
+		return msg.response(false)
+	}
+	delete(w.subscriptions, id)
+	return msg.response(true)
+}
+
+// notification is an event of the chain to be sent to the subscriptions of a
+// websocket connection, either a new head or deposit logs.
+type notification struct {
+	head *types.Header
+	logs []types.Log
+}
+
+// queueNotifications receives the events of the chain as soon as they are sent, and
+// queues them up in order until they are taken by the dispatch loop of the connection,
+// so that the chain never waits on the connection to send its events. It returns once
+// done is closed, which only happens after the connection unsubscribed from the chain,
+// as the chain may still be sending events after the connection is closed.
+func queueNotifications(
+	done <-chan struct{},
+	headChan <-chan *types.Header,
+	logsChan <-chan []types.Log,
+	out chan<- *notification,
+) {
+	var queue []*notification
+	for {
+		var next *notification
+		var nextChan chan<- *notification
+		if len(queue) > 0 {
+			next, nextChan = queue[0], out
+		}
+		select {
+		case <-done:
+			return
+		case head := <-headChan:
+			queue = append(queue, &notification{head: head})
+		case logs := <-logsChan:
+			queue = append(queue, &notification{logs: logs})
+		case nextChan <- next:
+			queue = queue[1:]
+		}
+	}
+}
+
+func (w *websocketHandler) notifyHead(codec ServerCodec, head *types.Header) {
+	for id, sub := range w.subscriptions {
+		if sub.name == newHeadsSubscription {
+			w.notify(codec, id, head)
+		}
+	}
+}
+
+// notifyLogs sends every log matching the criteria of a logs subscription as a separate
+// notification. Logs which were un-included from the chain carry removed: true.
+func (w *websocketHandler) notifyLogs(codec ServerCodec, logs []types.Log) {
+	for id, sub := range w.subscriptions {
+		if sub.name != logsSubscription {
+			continue
+		}
+		matched := eth1.FilterLogs(logs, 0, math.MaxUint64, sub.crit.Addresses, sub.crit.Topics)
+		for i := range matched {
+			w.notify(codec, id, &matched[i])
+		}
+	}
+}
+
+// notify sends a single result to the subscription with the given ID.
+func (w *websocketHandler) notify(codec ServerCodec, id rpc.ID, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.WithError(err).Error("Could not marshal subscription result")
+		return
+	}
+	params, err := json.Marshal(&subscriptionResult{ID: string(id), Result: data})
+	if err != nil {
+		log.WithError(err).Error("Could not marshal subscription result")
+		return
+	}
+	item := &jsonrpcMessage{
+		Version: vsn,
+		Method:  "eth" + notificationMethodSuffix,
+		Params:  params,
+	}
+	if err := codec.Write(context.Background(), item); err != nil {
+		log.Error(err)
+	}
+}
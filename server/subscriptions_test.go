@@ -0,0 +1,315 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/net/websocket"
+)
+
+// wsTestClient sends requests over a websocket connection, keeping the subscription
+// notifications received while waiting for responses.
+type wsTestClient struct {
+	t             *testing.T
+	conn          *websocket.Conn
+	nextID        int
+	notifications []*subscriptionResult
+}
+
+// dialWebsocket connects to the websocket endpoint at the given URL.
+func dialWebsocket(t *testing.T, url string, origin string) *wsTestClient {
+	conn, err := websocket.Dial(url, "", origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsTestClient{t: t, conn: conn}
+}
+
+// testWebsocket serves the websocket endpoint of a server which is not started, and
+// connects to it. The returned function closes both the connection and the endpoint.
+func testWebsocket(t *testing.T, srv *Server) (*wsTestClient, func()) {
+	wsSrv := httptest.NewServer(srv.ServeWebsocket())
+	client := dialWebsocket(t, "ws"+strings.TrimPrefix(wsSrv.URL, "http"), wsSrv.URL)
+	return client, func() {
+		client.conn.Close()
+		wsSrv.Close()
+	}
+}
+
+// read reads the next message, failing the test if none arrives within a few seconds,
+// such as when the server is deadlocked.
+func (c *wsTestClient) read() *jsonrpcMessage {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := new(jsonrpcMessage)
+	if err := websocket.JSON.Receive(c.conn, msg); err != nil {
+		c.t.Fatalf("Could not read a message: %v", err)
+	}
+	return msg
+}
+
+// call sends a request and returns its response.
+func (c *wsTestClient) call(method string, params string) *jsonrpcMessage {
+	c.nextID++
+	req := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, c.nextID, method, params)
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg.isNotification() {
+			c.notifications = append(c.notifications, c.decodeNotification(msg))
+			continue
+		}
+		if string(msg.ID) != fmt.Sprint(c.nextID) {
+			c.t.Fatalf("Expected the response to request %d, received %s", c.nextID, msg)
+		}
+		return msg
+	}
+}
+
+// subscribe creates a subscription and returns its ID.
+func (c *wsTestClient) subscribe(params string) string {
+	resp := c.call("eth_subscribe", params)
+	if resp.Error != nil {
+		c.t.Fatal(resp.Error)
+	}
+	var id string
+	if err := json.Unmarshal(resp.Result, &id); err != nil {
+		c.t.Fatal(err)
+	}
+	return id
+}
+
+// notification returns the next subscription notification.
+func (c *wsTestClient) notification() *subscriptionResult {
+	if len(c.notifications) > 0 {
+		n := c.notifications[0]
+		c.notifications = c.notifications[1:]
+		return n
+	}
+	msg := c.read()
+	if !msg.isNotification() {
+		c.t.Fatalf("Expected a notification, received %s", msg)
+	}
+	return c.decodeNotification(msg)
+}
+
+// expectNoNotification checks that no notification arrives within a short time.
+func (c *wsTestClient) expectNoNotification() {
+	if len(c.notifications) > 0 {
+		c.t.Fatalf("Expected no notification, received %s", c.notifications[0].Result)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	msg := new(jsonrpcMessage)
+	if err := websocket.JSON.Receive(c.conn, msg); err == nil {
+		c.t.Fatalf("Expected no notification, received %s", msg)
+	}
+}
+
+func (c *wsTestClient) decodeNotification(msg *jsonrpcMessage) *subscriptionResult {
+	n := new(subscriptionResult)
+	if err := json.Unmarshal(msg.Params, n); err != nil {
+		c.t.Fatal(err)
+	}
+	return n
+}
+
+// notifiedHead decodes the header of a newHeads notification.
+func notifiedHead(t *testing.T, n *subscriptionResult) *types.Header {
+	head := new(types.Header)
+	if err := json.Unmarshal(n.Result, head); err != nil {
+		t.Fatalf("Expected a header, received %s: %v", n.Result, err)
+	}
+	return head
+}
+
+// notifiedLog decodes the log of a logs notification.
+func notifiedLog(t *testing.T, n *subscriptionResult) *types.Log {
+	l := new(types.Log)
+	if err := json.Unmarshal(n.Result, l); err != nil {
+		t.Fatalf("Expected a log, received %s: %v", n.Result, err)
+	}
+	return l
+}
+
+func TestQueueNotifications(t *testing.T) {
+	done := make(chan struct{})
+	headChan := make(chan *types.Header)
+	logsChan := make(chan []types.Log)
+	out := make(chan *notification)
+	returned := make(chan struct{})
+	go func() {
+		queueNotifications(done, headChan, logsChan, out)
+		close(returned)
+	}()
+
+	// Events are received without waiting for the connection to take them, and are
+	// taken in the order they were sent.
+	heads := []*types.Header{{Number: big.NewInt(1)}, {Number: big.NewInt(2)}}
+	headChan <- heads[0]
+	logsChan <- []types.Log{{Index: 1}}
+	headChan <- heads[1]
+	if n := <-out; n.head != heads[0] {
+		t.Errorf("Expected the first head, received %+v", n)
+	}
+	if n := <-out; len(n.logs) != 1 {
+		t.Errorf("Expected the logs, received %+v", n)
+	}
+	// Events keep being received until done is closed, even if never taken.
+	headChan <- heads[1]
+	close(done)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the queue to stop once done is closed")
+	}
+}
+
+func TestWebsocket_ReorgNotifications(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	client, closeClient := testWebsocket(t, srv)
+	defer closeClient()
+	headsID := client.subscribe(`["newHeads"]`)
+	logsID := client.subscribe(`["logs",{}]`)
+
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	srv.chain.mineBlock()
+	if err := srv.chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	srv.chain.mineBlock()
+	// The head of each block comes before its logs.
+	for _, expected := range []string{headsID, logsID, logsID, headsID, logsID} {
+		if n := client.notification(); n.ID != expected {
+			t.Fatalf("Expected a notification of subscription %s, received %s", expected, n.Result)
+		}
+	}
+
+	// A reorg over the connection which also receives its notifications sends more
+	// events than the connection buffers, which must not block the chain.
+	resp := client.call("mock_reorg", `["0x2"]`)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	newHead := new(types.Header)
+	if err := json.Unmarshal(resp.Result, newHead); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		n := client.notification()
+		if n.ID != logsID || !notifiedLog(t, n).Removed {
+			t.Fatalf("Expected removed log %d of the replaced blocks, received %s", i, n.Result)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		n := client.notification()
+		if n.ID != headsID {
+			t.Fatalf("Expected head %d of the new branch, received %s", i, n.Result)
+		}
+		if i == 1 && notifiedHead(t, n).Hash() != newHead.Hash() {
+			t.Errorf("Expected the new head %#x, received %#x", newHead.Hash(), notifiedHead(t, n).Hash())
+		}
+	}
+	for i := 0; i < 3; i++ {
+		n := client.notification()
+		if n.ID != logsID || notifiedLog(t, n).Removed {
+			t.Fatalf("Expected log %d included again on the new branch, received %s", i, n.Result)
+		}
+	}
+	client.expectNoNotification()
+}
+
+func TestWebsocket_Unsubscribe(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	client, closeClient := testWebsocket(t, srv)
+	defer closeClient()
+	first := client.subscribe(`["newHeads"]`)
+	second := client.subscribe(`["newHeads"]`)
+	if first == second {
+		t.Fatalf("Expected unique subscription IDs, received %s twice", first)
+	}
+
+	// Every subscription of the connection is notified of the new head.
+	head := srv.chain.mineBlock()
+	notified := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		n := client.notification()
+		if h := notifiedHead(t, n); h.Hash() != head.Hash() {
+			t.Errorf("Expected head %#x, received %#x", head.Hash(), h.Hash())
+		}
+		notified[n.ID] = true
+	}
+	if !notified[first] || !notified[second] {
+		t.Fatalf("Expected both subscriptions to be notified, received %v", notified)
+	}
+
+	unsubscribe := func(id string) bool {
+		resp := client.call("eth_unsubscribe", fmt.Sprintf(`["%s"]`, id))
+		if resp.Error != nil {
+			t.Fatal(resp.Error)
+		}
+		var ok bool
+		if err := json.Unmarshal(resp.Result, &ok); err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !unsubscribe(first) {
+		t.Error("Expected true unsubscribing an active subscription")
+	}
+	if unsubscribe(first) {
+		t.Error("Expected false unsubscribing a subscription twice")
+	}
+
+	// Only the remaining subscription is notified once the other is cancelled.
+	srv.chain.mineBlock()
+	if n := client.notification(); n.ID != second {
+		t.Errorf("Expected a notification of subscription %s, received one of %s", second, n.ID)
+	}
+	client.expectNoNotification()
+	if !unsubscribe(second) {
+		t.Error("Expected true unsubscribing the last subscription")
+	}
+	srv.chain.mineBlock()
+	client.expectNoNotification()
+}
+
+func TestWebsocket_FilteredLogs(t *testing.T) {
+	srv := testServer(t, 8, 1)
+	client, closeClient := testWebsocket(t, srv)
+	defer closeClient()
+	headLogs, err := srv.chain.filterLogs(filterCriteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := headLogs[0].Address
+	topic := headLogs[0].Topics[0]
+	client.subscribe(`["logs",{"address":"0x0000000000000000000000000000000000000001"}]`)
+	client.subscribe(`["logs",{"topics":["0x0000000000000000000000000000000000000000000000000000000000000001"]}]`)
+	matching := client.subscribe(fmt.Sprintf(`["logs",{"address":"%s","topics":[["%s"]]}]`, contract.Hex(), topic.Hex()))
+
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	head := srv.chain.mineBlock()
+	// Only the subscription matching the deposit logs is notified, once per log.
+	for i := uint(0); i < 2; i++ {
+		n := client.notification()
+		if n.ID != matching {
+			t.Fatalf("Expected a notification of the matching subscription %s, received one of %s", matching, n.ID)
+		}
+		l := notifiedLog(t, n)
+		if l.Address != contract || l.Topics[0] != topic || l.BlockHash != head.Hash() || l.Index != i {
+			t.Errorf("Unexpected log %d notified: %+v", i, l)
+		}
+	}
+	client.expectNoNotification()
+}
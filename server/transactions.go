@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+var errKnownTransaction = errors.New("already known")
+
+// depositTransaction is the transaction which submitted a deposit, along with the
+// log of the deposit, whose block and indices are only set once it is included.
+type depositTransaction struct {
+	tx                *types.Transaction
+	log               types.Log
+	included          bool
+	cumulativeGasUsed uint64 // Gas used by the block up to and including the transaction.
+}
+
+// SendRawTransaction submits a signed transaction calling the deposit function of the
+// deposit contract, as sent by deposit tools through eth_sendRawTransaction. Its deposit
+// is verified and included in the next block produced, and its hash is returned.
+func (s *Server) SendRawTransaction(raw []byte) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return common.Hash{}, err
+	}
+	deposit, err := eth1.DecodeDepositTransaction(tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if *tx.To() != s.chain.depositContract {
+		return common.Hash{}, fmt.Errorf("transaction calls %#x instead of the deposit contract %#x", *tx.To(), s.chain.depositContract)
+	}
+	if err := eth1.VerifyDepositData(deposit); err != nil {
+		return common.Hash{}, err
+	}
+	if tx.Protected() && tx.ChainId().Cmp(new(big.Int).SetUint64(s.chainID)) != 0 {
+		return common.Hash{}, fmt.Errorf("transaction is signed for chain %d instead of chain %d", tx.ChainId(), s.chainID)
+	}
+	if _, err := txSender(tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.chain.submitDeposit(deposit, tx); err != nil {
+		return common.Hash{}, err
+	}
+	log.WithField("txHash", tx.Hash().Hex()).Info("Queued deposit transaction for the next block")
+	s.notifyDepositsQueued()
+	return tx.Hash(), nil
+}
+
+// submitDeposit queues up a deposit submitted by a transaction to be included in the
+// next block, after the deposits from the keystore which are already queued up. The
+// deposits from the keystore which are still available move one index further.
+func (c *chainStore) submitDeposit(deposit *eth1.DepositData, tx *types.Transaction) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.txIndicesByHash[tx.Hash()]; ok {
+		return errKnownTransaction
+	}
+
+	// The deposits, transactions, leaves and logs are copied rather than modified in
+	// place, as the included deposits may still be read by callers of includedDeposits,
+	// and snapshots share them with the live chain.
+	pos := c.numDepositsReadyToSend + c.depositsToSend
+	deposits := make([]*eth1.DepositData, 0, len(c.deposits)+1)
+	deposits = append(deposits, c.deposits[:pos]...)
+	deposits = append(deposits, deposit)
+	deposits = append(deposits, c.deposits[pos:]...)
+	txs := make([]*types.Transaction, 0, len(c.depositTxs)+1)
+	txs = append(txs, c.depositTxs[:pos]...)
+	txs = append(txs, tx)
+	txs = append(txs, c.depositTxs[pos:]...)
+	leaf, err := eth1.DepositLeaf(deposit)
+	if err != nil {
+		return err
+	}
+	leaves := make([][32]byte, 0, len(c.depositLeaves)+1)
+	leaves = append(leaves, c.depositLeaves[:pos]...)
+	leaves = append(leaves, leaf)
+	leaves = append(leaves, c.depositLeaves[pos:]...)
+	logs := make([]types.Log, len(deposits))
+	copy(logs, c.eth1Logs[:pos])
+	for i := pos; i < len(deposits); i++ {
+		l, err := eth1.DepositEventLog(deposits[i], uint64(i), c.depositContract)
+		if err != nil {
+			return err
+		}
+		l.TxHash = txs[i].Hash()
+		logs[i] = l
+	}
+
+	c.deposits = deposits
+	c.depositTxs = txs
+	c.txIndicesByHash = txIndices(txs)
+	c.depositLeaves = leaves
+	c.eth1Logs = logs
+	c.depositsToSend++
+	c.markChanged()
+	return nil
+}
+
+// transactionByHash returns the deposit transaction with the given hash, or nil if
+// there is none.
+func (c *chainStore) transactionByHash(hash common.Hash) *depositTransaction {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	i, ok := c.txIndicesByHash[hash]
+	if !ok {
+		return nil
+	}
+	return c.depositTransaction(i)
+}
+
+// blockWithTransactions returns the block at the given height along with the deposit
+// transactions it includes, in order, or a nil block if it does not exist.
+func (c *chainStore) blockWithTransactions(num uint64) (*types.Header, []*depositTransaction) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	head, ok := c.eth1BlocksByNumber[num]
+	if !ok {
+		return nil, nil
+	}
+	return head, c.blockTransactions(num)
+}
+
+// blockTransactions returns the deposit transactions included in the block at the
+// given height, in order. The caller must hold the lock.
+func (c *chainStore) blockTransactions(num uint64) []*depositTransaction {
+	included := c.eth1Logs[:c.numDepositsReadyToSend]
+	// Deposits are included in order, so their logs are sorted by block number.
+	start := sort.Search(len(included), func(i int) bool {
+		return included[i].BlockNumber >= num
+	})
+	txs := make([]*depositTransaction, 0)
+	for i := start; i < len(included) && included[i].BlockNumber == num; i++ {
+		txs = append(txs, c.depositTransaction(i))
+	}
+	return txs
+}
+
+// depositTransaction returns the transaction of the deposit at the given index.
+// The caller must hold the lock.
+func (c *chainStore) depositTransaction(i int) *depositTransaction {
+	dtx := &depositTransaction{
+		tx:       c.depositTxs[i],
+		log:      c.eth1Logs[i],
+		included: i < c.numDepositsReadyToSend,
+	}
+	if dtx.included {
+		for j := i - int(dtx.log.TxIndex); j <= i; j++ {
+			dtx.cumulativeGasUsed += c.depositTxs[j].Gas()
+		}
+	}
+	return dtx
+}
+
+// blockHeader returns a header on top of the given parent which includes the deposits
+// in the range [from, to), whose logs are used to compute the receipts of the block.
+// The caller must hold the lock.
+func (c *chainStore) blockHeader(
+	num uint64,
+	parentHash common.Hash,
+	timestamp uint64,
+	seed []byte,
+	from int,
+	to int,
+) *types.Header {
+	txs := c.depositTxs[from:to]
+	receipts := eth1.DepositReceipts(txs, c.eth1Logs[from:to])
+	return eth1.BlockHeader(num, parentHash, timestamp, seed, txs, receipts)
+}
+
+// indexLogs sets the transaction and log index of the included deposit logs within
+// their block, starting from the given deposit. Every deposit is submitted by its own
+// transaction emitting a single log. The caller must hold the lock.
+func (c *chainStore) indexLogs(from int) {
+	for i := from; i < c.numDepositsReadyToSend; i++ {
+		if i > 0 && c.eth1Logs[i].BlockHash == c.eth1Logs[i-1].BlockHash {
+			c.eth1Logs[i].TxIndex = c.eth1Logs[i-1].TxIndex + 1
+		} else {
+			c.eth1Logs[i].TxIndex = 0
+		}
+		c.eth1Logs[i].Index = c.eth1Logs[i].TxIndex
+	}
+}
+
+// depositLogs returns the logs emitted by the deposit contract for a list of deposits,
+// each emitted by the transaction which submitted the deposit.
+func depositLogs(
+	deposits []*eth1.DepositData,
+	txs []*types.Transaction,
+	contract common.Address,
+) ([]types.Log, error) {
+	logs, err := eth1.DepositEventLogs(deposits, contract)
+	if err != nil {
+		return nil, err
+	}
+	for i := range logs {
+		logs[i].TxHash = txs[i].Hash()
+	}
+	return logs, nil
+}
+
+// txIndices maps the hashes of a list of transactions to their index.
+func txIndices(txs []*types.Transaction) map[common.Hash]int {
+	m := make(map[common.Hash]int, len(txs))
+	for i, tx := range txs {
+		m[tx.Hash()] = i
+	}
+	return m
+}
+
+// txSender recovers the sender of a signed transaction.
+func txSender(tx *types.Transaction) (common.Address, error) {
+	if tx.Protected() {
+		return types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	}
+	return types.Sender(types.HomesteadSigner{}, tx)
+}
+
+// rpcTransaction returns the JSON-RPC representation of a transaction, as served by
+// eth_getTransactionByHash and in blocks with full transactions.
+func rpcTransaction(dtx *depositTransaction) map[string]interface{} {
+	tx := dtx.tx
+	from, _ := txSender(tx)
+	v, r, s := tx.RawSignatureValues()
+	fields := map[string]interface{}{
+		"blockHash":        nil,
+		"blockNumber":      nil,
+		"from":             from,
+		"gas":              hexutil.Uint64(tx.Gas()),
+		"gasPrice":         (*hexutil.Big)(tx.GasPrice()),
+		"hash":             tx.Hash(),
+		"input":            hexutil.Bytes(tx.Data()),
+		"nonce":            hexutil.Uint64(tx.Nonce()),
+		"to":               tx.To(),
+		"transactionIndex": nil,
+		"value":            (*hexutil.Big)(tx.Value()),
+		"v":                (*hexutil.Big)(v),
+		"r":                (*hexutil.Big)(r),
+		"s":                (*hexutil.Big)(s),
+	}
+	if dtx.included {
+		fields["blockHash"] = dtx.log.BlockHash
+		fields["blockNumber"] = hexutil.Uint64(dtx.log.BlockNumber)
+		fields["transactionIndex"] = hexutil.Uint64(dtx.log.TxIndex)
+	}
+	return fields
+}
+
+// rpcReceipt returns the JSON-RPC representation of the receipt of an included
+// transaction, as served by eth_getTransactionReceipt. Deposits never fail, and
+// their transaction uses all of its gas.
+func rpcReceipt(dtx *depositTransaction) map[string]interface{} {
+	tx := dtx.tx
+	from, _ := txSender(tx)
+	l := dtx.log
+	receipt := &types.Receipt{Logs: []*types.Log{&l}}
+	return map[string]interface{}{
+		"blockHash":         l.BlockHash,
+		"blockNumber":       hexutil.Uint64(l.BlockNumber),
+		"transactionHash":   tx.Hash(),
+		"transactionIndex":  hexutil.Uint64(l.TxIndex),
+		"from":              from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(tx.Gas()),
+		"cumulativeGasUsed": hexutil.Uint64(dtx.cumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              []*types.Log{&l},
+		"logsBloom":         types.CreateBloom(types.Receipts{receipt}),
+		"status":            hexutil.Uint64(types.ReceiptStatusSuccessful),
+	}
+}
+
+// rpcBlock returns the JSON-RPC representation of a block, as served by
+// eth_getBlockByNumber and eth_getBlockByHash, with either the hashes or the full
+// objects of its transactions.
+func rpcBlock(head *types.Header, txs []*depositTransaction, fullTx bool) (map[string]interface{}, error) {
+	// The header fields are encoded the same way as a header on its own, as served
+	// to newHeads subscriptions.
+	enc, err := json.Marshal(head)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return nil, err
+	}
+	rawTxs := make([]*types.Transaction, len(txs))
+	transactions := make([]interface{}, len(txs))
+	for i, dtx := range txs {
+		rawTxs[i] = dtx.tx
+		if fullTx {
+			transactions[i] = rpcTransaction(dtx)
+		} else {
+			transactions[i] = dtx.tx.Hash()
+		}
+	}
+	fields["transactions"] = transactions
+	fields["uncles"] = []common.Hash{}
+	fields["size"] = hexutil.Uint64(types.NewBlockWithHeader(head).WithBody(rawTxs, nil).Size())
+	return fields, nil
+}
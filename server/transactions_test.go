@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/prysmaticlabs/eth1-mock-rpc/eth1"
+)
+
+// signedDepositTransaction returns a raw transaction signed with the given signer,
+// calling the deposit function of the contract at the given address with a deposit
+// created from the given keys.
+func signedDepositTransaction(t *testing.T, signer types.Signer, to common.Address, validatorKey []byte, withdrawalKey []byte, amount uint64) []byte {
+	deposit, err := eth1.CreateDepositData(validatorKey, withdrawalKey, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := eth1.DepositCallData(deposit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(0, to, eth1.DepositValue(deposit), 1000000, big.NewInt(1), data)
+	signed, err := types.SignTx(tx, signer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestServer_SendRawTransaction(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	if err := srv.chain.queueDeposits(1); err != nil {
+		t.Fatal(err)
+	}
+	raw := signedDepositTransaction(t, types.HomesteadSigner{}, defaultDepositContract, bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	txHash, err := srv.SendRawTransaction(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.SendRawTransaction(raw); err != errKnownTransaction {
+		t.Errorf("Expected %v sending a transaction twice, received %v", errKnownTransaction, err)
+	}
+	status := srv.chain.depositStatus()
+	if status.Total != 5 || status.Pending != 2 || status.Available != 2 {
+		t.Errorf("Unexpected deposit status after sending a transaction: %+v", status)
+	}
+
+	head := srv.chain.mineBlock()
+	hash := head.Hash()
+	logs, err := srv.chain.filterLogs(filterCriteria{BlockHash: &hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 logs in the mined block, received %d", len(logs))
+	}
+	if logs[1].Address != defaultDepositContract {
+		t.Errorf("Expected the log to be emitted by the deposit contract %#x, received %#x", defaultDepositContract, logs[1].Address)
+	}
+	if logs[1].TxHash != txHash {
+		t.Errorf("Expected the second log to be emitted by transaction %#x, received %#x", txHash, logs[1].TxHash)
+	}
+	// The deposits from the keystore which are still available come after the
+	// deposit of the transaction.
+	available, err := eth1.DepositEventLog(srv.chain.deposits[3], 3, defaultDepositContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(srv.chain.eth1Logs[3].Data, available.Data) {
+		t.Error("Expected the log of an available deposit to be updated with its new index")
+	}
+
+	invalid := signedDepositTransaction(t, types.HomesteadSigner{}, defaultDepositContract, bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), eth1.MinDepositAmount-1)
+	if _, err := srv.SendRawTransaction(invalid); err == nil {
+		t.Error("Expected an error sending a deposit below the minimum amount")
+	}
+	otherContract := signedDepositTransaction(t, types.HomesteadSigner{}, common.Address{}, bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	if _, err := srv.SendRawTransaction(otherContract); err == nil {
+		t.Error("Expected an error sending a deposit to another contract than the deposit contract")
+	}
+
+	// Transactions protected against replays must be signed for the chain of the server.
+	protected := signedDepositTransaction(t, types.NewEIP155Signer(big.NewInt(defaultChainID)), defaultDepositContract, bytes.Repeat([]byte{3}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	if _, err := srv.SendRawTransaction(protected); err != nil {
+		t.Errorf("Expected a transaction signed for chain %d to be accepted, received %v", defaultChainID, err)
+	}
+	otherChain := signedDepositTransaction(t, types.NewEIP155Signer(big.NewInt(1)), defaultDepositContract, bytes.Repeat([]byte{4}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	if _, err := srv.SendRawTransaction(otherChain); err == nil {
+		t.Error("Expected an error sending a transaction signed for another chain")
+	}
+}
+
+func TestServer_SendRawTransactionRPC(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	raw := signedDepositTransaction(t, types.HomesteadSigner{}, defaultDepositContract, bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), eth1.MaxEffectiveBalance)
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		t.Fatal(err)
+	}
+	resp := handleRequest(srv, "eth_sendRawTransaction", fmt.Sprintf(`["%#x"]`, raw))
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	var txHash common.Hash
+	if err := json.Unmarshal(resp.Result, &txHash); err != nil {
+		t.Fatal(err)
+	}
+	if txHash != tx.Hash() {
+		t.Errorf("Expected transaction hash %#x, received %#x", tx.Hash(), txHash)
+	}
+	if status := srv.chain.depositStatus(); status.Pending != 1 {
+		t.Errorf("Expected the deposit of the transaction to be queued, received %+v", status)
+	}
+
+	srv.chain.mineBlock()
+	resp = handleRequest(srv, "eth_getTransactionReceipt", fmt.Sprintf(`["%s"]`, txHash.Hex()))
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if string(resp.Result) == "null" {
+		t.Error("Expected a receipt for the transaction once mined")
+	}
+	if resp := handleRequest(srv, "eth_sendRawTransaction", `["0x1234"]`); resp.Error == nil {
+		t.Error("Expected an error sending an undecodable transaction")
+	}
+}
+
+func TestChainStore_DepositTransactions(t *testing.T) {
+	srv := testServer(t, 4, 1)
+	if err := srv.chain.queueDeposits(2); err != nil {
+		t.Fatal(err)
+	}
+	pending := srv.chain.depositTxs[1].Hash()
+	if dtx := srv.chain.transactionByHash(pending); dtx == nil || dtx.included {
+		t.Fatal("Expected the transaction of a queued deposit to be known but not included")
+	}
+
+	head := srv.chain.mineBlock()
+	block, txs := srv.chain.blockWithTransactions(head.Number.Uint64())
+	if block.Hash() != head.Hash() {
+		t.Fatalf("Expected block %#x, received %#x", head.Hash(), block.Hash())
+	}
+	if len(txs) != 2 {
+		t.Fatalf("Expected 2 transactions in the mined block, received %d", len(txs))
+	}
+	if txs[0].tx.Hash() == txs[1].tx.Hash() {
+		t.Error("Expected every deposit to have a unique transaction hash")
+	}
+	for i, dtx := range txs {
+		if dtx.log.TxIndex != uint(i) || dtx.log.Index != uint(i) {
+			t.Errorf("Expected transaction and log index %d, received %d and %d", i, dtx.log.TxIndex, dtx.log.Index)
+		}
+		if dtx.log.TxHash != dtx.tx.Hash() {
+			t.Errorf("Expected log %d to be emitted by transaction %#x, received %#x", i, dtx.tx.Hash(), dtx.log.TxHash)
+		}
+	}
+	dtx := srv.chain.transactionByHash(pending)
+	if dtx == nil || !dtx.included || dtx.log.BlockHash != head.Hash() {
+		t.Fatal("Expected the transaction of the deposit to be included in the mined block")
+	}
+	receipt := rpcReceipt(dtx)
+	if receipt["cumulativeGasUsed"] != hexutil.Uint64(txs[0].tx.Gas()+txs[1].tx.Gas()) {
+		t.Errorf("Unexpected cumulative gas used %v of the second transaction", receipt["cumulativeGasUsed"])
+	}
+	fields, err := rpcBlock(head, txs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes := fields["transactions"].([]interface{}); len(hashes) != 2 || hashes[1] != pending {
+		t.Errorf("Expected the block to list the hashes of its transactions, received %v", hashes)
+	}
+	if fields["hash"] != head.Hash().Hex() {
+		t.Errorf("Expected block hash %#x, received %v", head.Hash(), fields["hash"])
+	}
+	if srv.chain.transactionByHash(common.Hash{}) != nil {
+		t.Error("Expected no transaction with an unknown hash")
+	}
+}
+
+func TestChainStore_HeaderRoots(t *testing.T) {
+	srv := testServer(t, 8, 2)
+	chain := srv.chain
+	genesisTxs := types.Transactions(chain.depositTxs[:2])
+	if root := chain.head().TxHash; root != types.DeriveSha(genesisTxs) {
+		t.Errorf("Expected the head to include the genesis deposits, received transactions root %#x", root)
+	}
+
+	if err := chain.queueDeposits(3); err != nil {
+		t.Fatal(err)
+	}
+	chain.mineBlock()
+	chain.mineBlock()
+	// The deposits move from the first to the second block of the competing branch.
+	if _, err := chain.reorg(2, reorgOptions{DepositDelay: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, num := range []uint64{startingBlockNumber + 1, startingBlockNumber + 2} {
+		head, txs := chain.blockWithTransactions(num)
+		rawTxs := make(types.Transactions, len(txs))
+		logs := make([]types.Log, len(txs))
+		for i, dtx := range txs {
+			rawTxs[i] = dtx.tx
+			logs[i] = dtx.log
+		}
+		if head.TxHash != types.DeriveSha(rawTxs) {
+			t.Errorf("Unexpected transactions root %#x of block %d with %d transactions", head.TxHash, num, len(txs))
+		}
+		if head.ReceiptHash != types.DeriveSha(eth1.DepositReceipts(rawTxs, logs)) {
+			t.Errorf("Unexpected receipts root %#x of block %d with %d transactions", head.ReceiptHash, num, len(txs))
+		}
+		gasUsed := uint64(0)
+		for _, tx := range rawTxs {
+			gasUsed += tx.Gas()
+		}
+		if head.GasUsed != gasUsed || head.GasLimit < gasUsed {
+			t.Errorf("Expected block %d to use %d gas within its limit, received %d out of %d", num, gasUsed, head.GasUsed, head.GasLimit)
+		}
+		if types.BloomLookup(head.Bloom, depositEventTopic(t)) != (len(txs) > 0) {
+			t.Errorf("Expected the logs bloom of block %d to contain the deposit topic only if it includes deposits", num)
+		}
+	}
+}
+
+// depositEventTopic returns the topic of the logs emitted by the deposit contract.
+func depositEventTopic(t *testing.T) common.Hash {
+	l, err := eth1.DepositEventLog(testDeposits(1)[0], 0, defaultDepositContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.Topics[0]
+}